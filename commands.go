@@ -0,0 +1,676 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/artem-streltsov/url-shortener/internal/config"
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/handlers"
+	"github.com/artem-streltsov/url-shortener/internal/importer"
+	"github.com/artem-streltsov/url-shortener/internal/jobs"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const programName = "url-shortener"
+
+// cliReason is recorded in the audit log for moderation actions taken from
+// the command line without a reason.
+const cliReason = "via command line"
+
+var errAdminRequired = errors.New("-admin is required")
+
+// command is a subcommand of the binary. Names of subcommands in a group,
+// such as "user create", consist of several words.
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(cfg *config.Config, args []string) error
+}
+
+// commands is filled in by init, because the help command refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "", "Run the web server; this is the default", serveCommand},
+		{"migrate", "[-dry-run]", "Apply pending database migrations", migrateCommand},
+		{"user list", "[-q query] [-limit n]", "List users", userListCommand},
+		{"user create", "[-admin] [-password-stdin] <username> <email>", "Create a user", userCreateCommand},
+		{"user disable", "-admin username [-links] [-reason reason] <username>", "Disable a user and optionally all of their links; the server may keep following the links for up to cache.ttl", userDisableCommand},
+		{"user enable", "-admin username [-reason reason] <username>", "Enable a disabled user", userEnableCommand},
+		{"user reset-password", "[-password-stdin] <username>", "Set a new password for a user", userResetPasswordCommand},
+		{"link list", "[-q query] [-filter flagged|disabled|reported] [-limit n]", "List the links of all users, newest first", linkListCommand},
+		{"link disable", "-admin username [-reason reason] <key>", "Disable a link; the server may keep following it for up to cache.ttl", linkDisableCommand},
+		{"link enable", "-admin username [-reason reason] <key>", "Enable a disabled link", linkEnableCommand},
+		{"link delete", "-admin username [-reason reason] <key>", "Delete a link and its clicks; the server may keep following it for up to cache.ttl", linkDeleteCommand},
+		{"rescan", "[-batch-size n]", "Run every link through the safety checkers now", rescanCommand},
+		{"export", "[-user username] [-format csv|json] [-o file] [-base-url url] links|clicks", "Export links or clicks, of all users unless -user is given", exportCommand},
+		{"import", "-user username [-format format] [-dry-run] <file>", "Import links from another URL shortener", importCommand},
+		{"config print", "", "Show the effective settings and where they were set, with secrets redacted", configPrintCommand},
+		{"help", "", "Show this help", helpCommand},
+	}
+}
+
+// runCommand runs the command named by the first arguments, or the server if
+// there are none. cfgErr is the error from loading cfg, which stops every
+// command except the ones that help to fix the configuration.
+func runCommand(cfg *config.Config, cfgErr error, args []string) error {
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) || strings.Join(args[:len(words)], " ") != cmd.name {
+			continue
+		}
+
+		switch {
+		case cfgErr == nil || cmd.name == "help":
+			return cmd.run(cfg, args[len(words):])
+		case cmd.name == "config print":
+			// Invalid settings are printed too, to show where a wrong
+			// value comes from.
+			if err := cmd.run(cfg, args[len(words):]); err != nil {
+				return err
+			}
+			return cfgErr
+		default:
+			return cfgErr
+		}
+	}
+
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", strings.Join(args, " "))
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [flags] <command> [arguments]\n\nCommands:\n", programName)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.description)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nSettings are read from the YAML or TOML file named by -config or $CONFIG_FILE, from\n"+
+		"environment variables and from flags, which come before the command; run %s -h to list them.\n", programName)
+}
+
+// newFlagSet returns the flags of a command, which print the usage of the
+// command on errors.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(flags.Output(), "Usage: %s %s %s\n\n%s.\n", programName, cmd.name, cmd.args, cmd.description)
+			}
+		}
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the arguments of a command and checks that n arguments
+// remain after the flags.
+func parseFlags(flags *flag.FlagSet, args []string, n int) error {
+	flags.Parse(args)
+	if flags.NArg() != n {
+		flags.Usage()
+		return fmt.Errorf("%s takes %d arguments, got %d", flags.Name(), n, flags.NArg())
+	}
+	return nil
+}
+
+func helpCommand(cfg *config.Config, args []string) error {
+	printUsage(os.Stdout)
+	return nil
+}
+
+func configPrintCommand(cfg *config.Config, args []string) error {
+	if err := parseFlags(newFlagSet("config print"), args, 0); err != nil {
+		return err
+	}
+	return cfg.Print(os.Stdout)
+}
+
+func serveCommand(cfg *config.Config, args []string) error {
+	if err := parseFlags(newFlagSet("serve"), args, 0); err != nil {
+		return err
+	}
+	return serve(cfg)
+}
+
+func migrateCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("migrate")
+	dryRun := flags.Bool("dry-run", false, "list pending migrations without applying them")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	migrations, err := db.Migrate(*dryRun)
+	if err != nil {
+		return fmt.Errorf("error migrating database: %w", err)
+	}
+
+	if *dryRun {
+		for _, migration := range migrations {
+			log.Printf("Pending migration %s", migration)
+		}
+		log.Printf("%d pending migrations", len(migrations))
+		return nil
+	}
+	for _, migration := range migrations {
+		log.Printf("Applied migration %s", migration)
+	}
+	log.Printf("%d migrations applied", len(migrations))
+	return nil
+}
+
+func userListCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("user list")
+	query := flags.String("q", "", "only list users whose username or email contains `query`")
+	limit := flags.Int("limit", 50, "list at most `n` users")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	db, err := openMigratedDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	users, err := db.SearchUsers(strings.ToLower(*query), *limit, 0)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSERNAME\tEMAIL\tADMIN\tDISABLED")
+	for _, user := range users {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%t\t%t\n", user.ID, user.Username, user.Email, user.IsAdmin, user.Disabled)
+	}
+	return tw.Flush()
+}
+
+func userCreateCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("user create")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from standard input instead of generating and printing a random one")
+	admin := flags.Bool("admin", false, "make the user an admin")
+	if err := parseFlags(flags, args, 2); err != nil {
+		return err
+	}
+	username, email := flags.Arg(0), flags.Arg(1)
+
+	db, err := openMigratedDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	existing, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("user %s already exists", username)
+	}
+
+	hashedPassword, err := newPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	user, err := db.CreateUser(username, email, hashedPassword)
+	if err != nil {
+		return err
+	}
+	if *admin {
+		if _, err := db.SetUserAdmin(username, true); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Created user %s with ID %d", user.Username, user.ID)
+	return nil
+}
+
+func userDisableCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("user disable")
+	admin := flags.String("admin", "", "`username` of the admin recorded in the audit log")
+	links := flags.Bool("links", false, "also disable all links of the user")
+	reason := flags.String("reason", cliReason, "reason recorded in the audit log")
+	if err := parseModerationFlags(flags, args, admin); err != nil {
+		return err
+	}
+
+	return withUser(cfg, flags.Arg(0), func(db *database.DB, user *database.User) error {
+		moderator, err := getAdmin(db, *admin)
+		if err != nil {
+			return err
+		}
+		if user.ID == moderator.ID {
+			return errors.New("admins cannot disable themselves")
+		}
+		if err := db.SetUserDisabled(moderator.ID, user.ID, true, *links, *reason); err != nil {
+			return err
+		}
+		log.Printf("Disabled user %s", user.Username)
+		if *links {
+			warnCached(cfg, "their links")
+		}
+		return nil
+	})
+}
+
+func userEnableCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("user enable")
+	admin := flags.String("admin", "", "`username` of the admin recorded in the audit log")
+	reason := flags.String("reason", cliReason, "reason recorded in the audit log")
+	if err := parseModerationFlags(flags, args, admin); err != nil {
+		return err
+	}
+
+	return withUser(cfg, flags.Arg(0), func(db *database.DB, user *database.User) error {
+		moderator, err := getAdmin(db, *admin)
+		if err != nil {
+			return err
+		}
+		if err := db.SetUserDisabled(moderator.ID, user.ID, false, false, *reason); err != nil {
+			return err
+		}
+		log.Printf("Enabled user %s", user.Username)
+		return nil
+	})
+}
+
+func userResetPasswordCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("user reset-password")
+	passwordStdin := flags.Bool("password-stdin", false, "read the new password from standard input instead of generating and printing a random one")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	return withUser(cfg, flags.Arg(0), func(db *database.DB, user *database.User) error {
+		hashedPassword, err := newPassword(*passwordStdin)
+		if err != nil {
+			return err
+		}
+		if err := db.SetUserPassword(user.ID, hashedPassword); err != nil {
+			return err
+		}
+		log.Printf("Changed the password of user %s", user.Username)
+		return nil
+	})
+}
+
+// withUser calls fn with the user with the given username.
+func withUser(cfg *config.Config, username string, fn func(db *database.DB, user *database.User) error) error {
+	db, err := openMigratedDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+	return fn(db, user)
+}
+
+// parseModerationFlags parses the arguments of a moderation command, which
+// take one argument and require -admin.
+func parseModerationFlags(flags *flag.FlagSet, args []string, admin *string) error {
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	if *admin == "" {
+		flags.Usage()
+		return errAdminRequired
+	}
+	return nil
+}
+
+// getAdmin returns the enabled admin with the given username, who is recorded
+// as taking moderation actions from the command line.
+func getAdmin(db *database.DB, username string) (*database.User, error) {
+	admin, err := db.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if admin == nil || !admin.IsAdmin || admin.Disabled {
+		return nil, fmt.Errorf("%s is not an enabled admin", username)
+	}
+	return admin, nil
+}
+
+// warnCached warns that a running server keeps using the cached state of
+// links that were disabled or deleted from the command line, as it cannot
+// know about the change.
+func warnCached(cfg *config.Config, what string) {
+	log.Printf("A running server may keep following %s for up to %s (cache.ttl)", what, cfg.Cache.TTL)
+}
+
+// newPassword reads a password from the first line of standard input if
+// fromStdin is set, and otherwise generates a random password and prints it.
+// It returns the hash of the password. Passwords are not taken as flags,
+// which would show them in the process list and shell history.
+func newPassword(fromStdin bool) (string, error) {
+	var password string
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("error reading password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", errors.New("the password on standard input is empty")
+		}
+	} else {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("error generating password: %w", err)
+		}
+		password = base64.RawURLEncoding.EncodeToString(b)
+		fmt.Printf("Password: %s\n", password)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func linkListCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("link list")
+	query := flags.String("q", "", "only list links whose destination, key or owner contains `query`")
+	filter := flags.String("filter", database.URLFilterAll, "only list flagged, disabled or reported links")
+	limit := flags.Int("limit", 50, "list at most `n` links")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	db, err := openMigratedDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	urls, err := db.SearchURLs(strings.ToLower(*query), *filter, *limit, 0)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKEY\tOWNER\tCLICKS\tSTATUS\tURL")
+	for _, url := range urls {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", url.ID, url.Key, url.Owner, url.Clicks, linkStatus(&url), url.URL.URL)
+	}
+	return tw.Flush()
+}
+
+// linkStatus summarizes why a link does not redirect, if it does not.
+func linkStatus(url *database.URLWithOwner) string {
+	var status []string
+	if url.Disabled {
+		status = append(status, "disabled")
+	}
+	if url.IsFlagged() {
+		status = append(status, "flagged")
+	}
+	if url.IsExpired() {
+		status = append(status, "expired")
+	}
+	if url.Reports > 0 {
+		status = append(status, fmt.Sprintf("%d reports", url.Reports))
+	}
+	if len(status) == 0 {
+		return "active"
+	}
+	return strings.Join(status, ",")
+}
+
+func linkDisableCommand(cfg *config.Config, args []string) error {
+	return setLinkDisabled(cfg, "link disable", args, true)
+}
+
+func linkEnableCommand(cfg *config.Config, args []string) error {
+	return setLinkDisabled(cfg, "link enable", args, false)
+}
+
+func setLinkDisabled(cfg *config.Config, name string, args []string, disabled bool) error {
+	flags := newFlagSet(name)
+	admin := flags.String("admin", "", "`username` of the admin recorded in the audit log")
+	reason := flags.String("reason", cliReason, "reason recorded in the audit log")
+	if err := parseModerationFlags(flags, args, admin); err != nil {
+		return err
+	}
+
+	return withLink(cfg, flags.Arg(0), func(db *database.DB, url *database.URL) error {
+		moderator, err := getAdmin(db, *admin)
+		if err != nil {
+			return err
+		}
+		if err := db.SetURLDisabled(moderator.ID, url.ID, disabled, *reason); err != nil {
+			return err
+		}
+		if disabled {
+			log.Printf("Disabled link %s", url.Key)
+			warnCached(cfg, "it")
+		} else {
+			log.Printf("Enabled link %s", url.Key)
+		}
+		return nil
+	})
+}
+
+func linkDeleteCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("link delete")
+	admin := flags.String("admin", "", "`username` of the admin recorded in the audit log")
+	reason := flags.String("reason", cliReason, "reason recorded in the audit log")
+	if err := parseModerationFlags(flags, args, admin); err != nil {
+		return err
+	}
+
+	return withLink(cfg, flags.Arg(0), func(db *database.DB, url *database.URL) error {
+		moderator, err := getAdmin(db, *admin)
+		if err != nil {
+			return err
+		}
+		if err := db.ModerateDeleteURL(moderator.ID, url.ID, *reason); err != nil {
+			return err
+		}
+		log.Printf("Deleted link %s", url.Key)
+		warnCached(cfg, "it")
+		return nil
+	})
+}
+
+// withLink calls fn with the link with the given key, which may also be one
+// of its previous keys.
+func withLink(cfg *config.Config, key string, fn func(db *database.DB, url *database.URL) error) error {
+	db, err := openMigratedDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	url, err := db.GetURL(key)
+	if err != nil {
+		if errors.Is(err, database.ErrURLNotFound) {
+			return fmt.Errorf("link %s does not exist", key)
+		}
+		return err
+	}
+	return fn(db, url)
+}
+
+func rescanCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("rescan")
+	batchSize := flags.Int("batch-size", cfg.Safety.RescanBatchSize, "number of links loaded at a time")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	db, err := openMigratedDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	safety, err := newSafetyChecker(cfg.Safety)
+	if err != nil {
+		return err
+	}
+	defer safety.Close()
+
+	// An interrupted rescan keeps the results so far; the remaining links
+	// are checked by the next rescan.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	jobs.RescanAll(ctx, db, safety, *batchSize)
+	if ctx.Err() != nil {
+		return errors.New("rescan interrupted")
+	}
+	return nil
+}
+
+func exportCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("export")
+	username := flags.String("user", "", "only export the data of this user")
+	format := flags.String("format", handlers.ExportJSON, "csv or json")
+	output := flags.String("o", "", "write to `file` instead of standard output")
+	scheme := "http"
+	if cfg.TLS.Enabled() {
+		scheme = "https"
+	}
+	base := flags.String("base-url", fmt.Sprintf("%s://localhost:%d", scheme, cfg.Server.Port), "scheme and host of the short URLs in the export")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	dataset := flags.Arg(0)
+
+	db, err := openMigratedDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var userID int64
+	if *username != "" {
+		user, err := db.GetUserByUsername(*username)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return fmt.Errorf("user %s does not exist", *username)
+		}
+		userID = user.ID
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	buffered := bufio.NewWriter(w)
+	if err := handlers.Export(buffered, db, dataset, *format, strings.TrimRight(*base, "/"), userID); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	if *output != "" {
+		log.Printf("Exported %s to %s", dataset, *output)
+	}
+	return nil
+}
+
+func importCommand(cfg *config.Config, args []string) error {
+	flags := newFlagSet("import")
+	username := flags.String("user", "", "username that will own the imported links")
+	format := flags.String("format", importer.FormatCSV, "format of the file: "+strings.Join(importer.Formats, ", "))
+	dryRun := flags.Bool("dry-run", false, "check the file without creating any links")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	if *username == "" {
+		flags.Usage()
+		return errors.New("-user is required")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	links, err := importer.Parse(*format, file)
+	if err != nil {
+		return err
+	}
+
+	return withUser(cfg, *username, func(db *database.DB, user *database.User) error {
+		if err := setKeyGenerator(db, cfg.Keys); err != nil {
+			return err
+		}
+
+		safety, err := newSafetyChecker(cfg.Safety)
+		if err != nil {
+			return err
+		}
+		defer safety.Close()
+
+		results, err := importer.New(db, safety).Import(user.ID, links, *dryRun)
+		if err != nil {
+			return err
+		}
+
+		valid := 0
+		for _, result := range results {
+			if result.Error != "" {
+				log.Printf("Skipped link %d (key %q, %s): %s", result.Row, result.Key, result.URL, result.Error)
+				continue
+			}
+			valid++
+		}
+
+		if *dryRun {
+			log.Printf("%d of %d links can be imported", valid, len(results))
+		} else {
+			log.Printf("Imported %d of %d links for %s", valid, len(results), user.Username)
+		}
+		return nil
+	})
+}
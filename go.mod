@@ -3,12 +3,15 @@ module github.com/artem-streltsov/url-shortener
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v0.3.0
 	github.com/davidmytton/url-verifier v1.0.1
 	github.com/google/safebrowsing v0.0.0-20190624211811-bbf0d20d26b3
 	github.com/gorilla/sessions v1.2.1
 	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.10.9
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	golang.org/x/crypto v0.9.0
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.22.1
 )
 
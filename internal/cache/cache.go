@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+)
+
+// LRU is a size-bounded cache that evicts the least recently used entry and
+// treats entries older than their TTL as missing. It is not safe for
+// concurrent use; callers must provide their own locking.
+type LRU[K comparable, V any] struct {
+	capacity int
+	entries  map[K]*list.Element
+	order    *list.List
+
+	// OnEvict, if set, is called whenever an entry leaves the cache, whether
+	// it was evicted, expired, replaced or deleted.
+	OnEvict func(key K, value V)
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: capacity,
+		entries:  make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value stored under key if it has not expired.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	var zero V
+	element, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	e := element.Value.(*entry[K, V])
+	if !time.Now().Before(e.expiresAt) {
+		c.remove(element)
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	return e.value, true
+}
+
+// Set stores value under key for ttl, evicting the least recently used entry
+// if the cache is full.
+func (c *LRU[K, V]) Set(key K, value V, ttl time.Duration) {
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expiresAt: time.Now().Add(ttl)})
+
+	if c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU[K, V]) Delete(key K) bool {
+	element, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	c.remove(element)
+	return true
+}
+
+func (c *LRU[K, V]) Clear() {
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU[K, V]) Len() int {
+	return c.order.Len()
+}
+
+func (c *LRU[K, V]) remove(element *list.Element) {
+	e := c.order.Remove(element).(*entry[K, V])
+	delete(c.entries, e.key)
+	if c.OnEvict != nil {
+		c.OnEvict(e.key, e.value)
+	}
+}
@@ -0,0 +1,142 @@
+package clicks
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+)
+
+// Recorder queues click events in memory and writes them to the database in
+// batches, so that redirects do not wait for a database write.
+type Recorder struct {
+	db            database.Store
+	events        chan *database.Click
+	batchSize     int
+	flushInterval time.Duration
+	done          chan struct{}
+
+	// mu guards closed, so that Record does not send on a closed channel.
+	mu     sync.RWMutex
+	closed bool
+
+	queued  atomic.Int64
+	dropped atomic.Int64
+	written atomic.Int64
+	failed  atomic.Int64
+}
+
+// Stats are running totals since the recorder was started.
+type Stats struct {
+	Queued  int64 `json:"queued"`
+	Dropped int64 `json:"dropped"`
+	Written int64 `json:"written"`
+	Failed  int64 `json:"failed"`
+	Pending int   `json:"pending"`
+}
+
+// NewRecorder starts a recorder that buffers up to bufferSize events and
+// writes them once batchSize events are waiting or flushInterval has passed.
+func NewRecorder(db database.Store, bufferSize, batchSize int, flushInterval time.Duration) *Recorder {
+	r := &Recorder{
+		db:            db,
+		events:        make(chan *database.Click, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record queues a click without blocking. If the buffer is full or the
+// recorder is closed the click is dropped and counted, and false is returned.
+func (r *Recorder) Record(click *database.Click) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		r.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case r.events <- click:
+		r.queued.Add(1)
+		return true
+	default:
+		r.dropped.Add(1)
+		return false
+	}
+}
+
+// Close stops accepting clicks and waits until the queued ones have been
+// written or ctx is done. Requests that are still being handled may call
+// Record after Close, which drops their clicks.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.events)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) Stats() Stats {
+	return Stats{
+		Queued:  r.queued.Load(),
+		Dropped: r.dropped.Load(),
+		Written: r.written.Load(),
+		Failed:  r.failed.Load(),
+		Pending: len(r.events),
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*database.Click, 0, r.batchSize)
+	for {
+		select {
+		case click, ok := <-r.events:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= r.batchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (r *Recorder) flush(batch []*database.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := r.db.RecordClicks(batch); err != nil {
+		r.failed.Add(int64(len(batch)))
+		log.Printf("Error recording %d clicks: %v", len(batch), err)
+		return
+	}
+	r.written.Add(int64(len(batch)))
+}
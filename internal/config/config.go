@@ -0,0 +1,399 @@
+// Package config loads the settings of the server and the command line tools.
+// Each setting is read, in increasing order of precedence, from its default,
+// a YAML or TOML config file, an environment variable and a command line flag.
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/keygen"
+	"github.com/artem-streltsov/url-shortener/internal/safebrowsing"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	ExpiryMark  = "mark"
+	ExpiryPurge = "purge"
+)
+
+const (
+	TLSOff   = "off"
+	TLSFiles = "files"
+	TLSACME  = "acme"
+)
+
+// Config holds every setting. The key tag names a setting in config files and
+// on the command line, where it is joined to the keys of the enclosing
+// sections with dots, as in server.port. The env tag names its environment
+// variable. Settings tagged secret are redacted when printed; a secret of
+// "password" only hides the password of a connection URL.
+type Config struct {
+	Server   Server   `key:"server"`
+	TLS      TLS      `key:"tls"`
+	Database Database `key:"database"`
+	Safety   Safety   `key:"safety"`
+	Keys     Keys     `key:"keys"`
+	Expiry   Expiry   `key:"expiry"`
+	Clicks   Clicks   `key:"clicks"`
+	Cache    Cache    `key:"cache"`
+
+	// sources records where each setting was taken from, by key. Settings
+	// that are not in it have their default value.
+	sources map[string]string
+}
+
+type Server struct {
+	Port             int           `key:"port" env:"PORT" min:"1" help:"port the web server listens on"`
+	SessionSecretKey string        `key:"session_secret_key" env:"SESSION_SECRET_KEY" secret:"true" help:"key that signs session cookies and salts hashed visitor IPs"`
+	ThemeDir         string        `key:"theme_dir" env:"THEME_DIR" help:"directory whose templates and static subdirectories replace built-in files with the same name"`
+	DevMode          bool          `key:"dev_mode" env:"DEV_MODE" help:"read the built-in templates and static files from the source tree and reload templates when they change"`
+	AdminUsers       []string      `key:"admin_users" env:"ADMIN_USERS" help:"comma separated usernames that are given the admin role at startup"`
+	RateLimit        int           `key:"rate_limit" env:"RATE_LIMIT" min:"1" help:"requests a client may make per rate limit window"`
+	RateLimitWindow  time.Duration `key:"rate_limit_window" env:"RATE_LIMIT_WINDOW" help:"window of the rate limit"`
+	MetricsAddr      string        `key:"metrics_addr" env:"METRICS_ADDR" help:"address serving runtime counters at /debug/vars; keep this private"`
+	TrustProxy       bool          `key:"trust_proxy" env:"TRUST_PROXY" help:"take the scheme and client address of requests from the X-Forwarded-Proto and X-Forwarded-For headers of a reverse proxy"`
+}
+
+// TLS configures HTTPS. In the files mode the certificate is read from files,
+// and in the acme mode it is requested from an ACME server such as Let's
+// Encrypt. The server then listens for HTTPS on server.port.
+type TLS struct {
+	Mode          string        `key:"mode" env:"TLS_MODE" help:"how HTTPS is served: off, files or acme"`
+	CertFile      string        `key:"cert_file" env:"TLS_CERT_FILE" help:"PEM certificate chain of the files mode"`
+	KeyFile       string        `key:"key_file" env:"TLS_KEY_FILE" help:"PEM private key of the files mode"`
+	ACMEDomains   []string      `key:"acme_domains" env:"ACME_DOMAINS" help:"comma separated domains that certificates are requested for"`
+	ACMEEmail     string        `key:"acme_email" env:"ACME_EMAIL" help:"contact address of the ACME account"`
+	ACMEDirectory string        `key:"acme_directory" env:"ACME_DIRECTORY" help:"directory URL of the ACME server"`
+	ACMECAFile    string        `key:"acme_ca_file" env:"ACME_CA_FILE" help:"PEM root certificate of the ACME server if it is not publicly trusted, as for a test server"`
+	ACMECacheDir  string        `key:"acme_cache_dir" env:"ACME_CACHE_DIR" help:"where certificates and the ACME account key are kept"`
+	HTTPPort      int           `key:"http_port" env:"TLS_HTTP_PORT" min:"0" help:"port of a plain HTTP listener that redirects to HTTPS and answers ACME challenges; 0 turns it off"`
+	HSTSMaxAge    time.Duration `key:"hsts_max_age" env:"HSTS_MAX_AGE" min:"0" help:"max-age of the Strict-Transport-Security header of HTTPS responses; 0 leaves it out"`
+}
+
+// Enabled reports whether the server listens for HTTPS.
+func (t TLS) Enabled() bool {
+	return t.Mode != TLSOff
+}
+
+type Database struct {
+	Path string `key:"path" env:"DB_PATH" help:"SQLite database file, created if needed"`
+	URL  string `key:"url" env:"DATABASE_URL" secret:"password" help:"PostgreSQL connection string; the SQLite file is ignored if set"`
+}
+
+type Safety struct {
+	Checkers             []string      `key:"checkers" env:"SAFETY_CHECKERS" help:"comma separated safety checkers: google, blocklist and noop"`
+	GoogleAPIKey         string        `key:"google_api_key" env:"SAFE_BROWSING_API_KEY" secret:"true" help:"Google Safe Browsing API key"`
+	GoogleDBPath         string        `key:"google_db_path" env:"SAFE_BROWSING_DB_PATH" help:"where the Google checker keeps its local threat lists"`
+	BlocklistPath        string        `key:"blocklist_path" env:"SAFETY_BLOCKLIST_PATH" help:"blocklist file of the blocklist checker"`
+	RescanInterval       time.Duration `key:"rescan_interval" env:"SAFETY_RESCAN_INTERVAL" help:"how often stored destinations are checked again"`
+	RescanBatchSize      int           `key:"rescan_batch_size" env:"SAFETY_RESCAN_BATCH_SIZE" min:"1" help:"number of links loaded at a time by a rescan"`
+	AllowProceed         bool          `key:"allow_proceed" env:"SAFETY_ALLOW_PROCEED" help:"let visitors continue past the warning page for low severity threats"`
+	AbuseReportThreshold int           `key:"abuse_report_threshold" env:"ABUSE_REPORT_THRESHOLD" min:"0" help:"reports after which a link is disabled; 0 never disables links automatically"`
+}
+
+type Keys struct {
+	Strategy string `key:"strategy" env:"KEY_STRATEGY" help:"how keys for new links are generated: random or counter"`
+	Length   int    `key:"length" env:"KEY_LENGTH" min:"1" help:"length of generated keys"`
+	Salt     string `key:"salt" env:"KEY_SALT" secret:"true" help:"salt of the counter strategy; changing it changes which keys are produced"`
+}
+
+type Expiry struct {
+	SweepInterval time.Duration `key:"sweep_interval" env:"EXPIRY_SWEEP_INTERVAL" help:"how often expired links are swept"`
+	Action        string        `key:"action" env:"EXPIRED_LINKS" help:"whether expired links are marked as expired or deleted: mark or purge"`
+}
+
+// Purge reports whether expired links are deleted rather than marked.
+func (e Expiry) Purge() bool {
+	return e.Action == ExpiryPurge
+}
+
+type Clicks struct {
+	BufferSize    int           `key:"buffer_size" env:"CLICK_BUFFER_SIZE" min:"1" help:"number of clicks queued in memory"`
+	BatchSize     int           `key:"batch_size" env:"CLICK_BATCH_SIZE" min:"1" help:"number of clicks written at a time"`
+	FlushInterval time.Duration `key:"flush_interval" env:"CLICK_FLUSH_INTERVAL" help:"how often queued clicks are written"`
+}
+
+type Cache struct {
+	Size        int           `key:"size" env:"URL_CACHE_SIZE" min:"1" help:"number of short URL lookups cached in memory"`
+	TTL         time.Duration `key:"ttl" env:"URL_CACHE_TTL" help:"how long a lookup is cached"`
+	NegativeTTL time.Duration `key:"negative_ttl" env:"URL_CACHE_NEGATIVE_TTL" min:"0" help:"how long an unknown key is cached; 0 turns it off"`
+}
+
+// Default returns the configuration used when nothing is set. It has no
+// database or session secret, which have to be set.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            8080,
+			RateLimit:       100,
+			RateLimitWindow: time.Minute,
+		},
+		TLS: TLS{
+			Mode:          TLSOff,
+			ACMEDirectory: acme.LetsEncryptURL,
+			ACMECacheDir:  "database/acme",
+			HTTPPort:      80,
+			HSTSMaxAge:    365 * 24 * time.Hour,
+		},
+		Safety: Safety{
+			Checkers:             []string{safebrowsing.CheckerGoogle},
+			GoogleDBPath:         "database/safebrowsing_db",
+			RescanInterval:       24 * time.Hour,
+			RescanBatchSize:      100,
+			AbuseReportThreshold: 5,
+		},
+		Keys: Keys{
+			Strategy: keygen.StrategyRandom,
+			Length:   keygen.DefaultLength,
+		},
+		Expiry: Expiry{
+			SweepInterval: 10 * time.Minute,
+			Action:        ExpiryMark,
+		},
+		Clicks: Clicks{
+			BufferSize:    10000,
+			BatchSize:     100,
+			FlushInterval: time.Second,
+		},
+		Cache: Cache{
+			Size:        10000,
+			TTL:         5 * time.Minute,
+			NegativeTTL: time.Minute,
+		},
+		sources: make(map[string]string),
+	}
+}
+
+// Errors lists every problem found in a configuration.
+type Errors []string
+
+func (e Errors) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// validate checks the settings against each other and their allowed values.
+func (c *Config) validate() Errors {
+	var errs Errors
+	for _, s := range c.settings() {
+		switch v := s.value.Addr().Interface().(type) {
+		case *int:
+			if s.min == "1" && *v < 1 {
+				errs = append(errs, fmt.Sprintf("%s must be a positive number, got %d", s, *v))
+			}
+			if s.min == "0" && *v < 0 {
+				errs = append(errs, fmt.Sprintf("%s must be zero or a positive number, got %d", s, *v))
+			}
+		case *time.Duration:
+			if s.min == "0" && *v < 0 {
+				errs = append(errs, fmt.Sprintf("%s must be zero or a positive duration, got %s", s, *v))
+			}
+			if s.min == "" && *v <= 0 {
+				errs = append(errs, fmt.Sprintf("%s must be a positive duration, got %s", s, *v))
+			}
+		}
+	}
+
+	if c.Server.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("server.port (PORT) must be at most 65535, got %d", c.Server.Port))
+	}
+	if c.Server.SessionSecretKey == "" {
+		errs = append(errs, "server.session_secret_key (SESSION_SECRET_KEY) must be set")
+	}
+	if c.Server.ThemeDir != "" {
+		if info, err := os.Stat(c.Server.ThemeDir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Sprintf("server.theme_dir (THEME_DIR) must be a directory, got %q", c.Server.ThemeDir))
+		}
+	}
+	switch c.TLS.Mode {
+	case TLSOff:
+	case TLSFiles:
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			errs = append(errs, "tls.cert_file (TLS_CERT_FILE) and tls.key_file (TLS_KEY_FILE) must be set for the files mode")
+		}
+	case TLSACME:
+		if len(c.TLS.ACMEDomains) == 0 {
+			errs = append(errs, "tls.acme_domains (ACME_DOMAINS) must be set for the acme mode")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("tls.mode (TLS_MODE) must be off, files or acme, got %q", c.TLS.Mode))
+	}
+	if c.TLS.HTTPPort > 65535 {
+		errs = append(errs, fmt.Sprintf("tls.http_port (TLS_HTTP_PORT) must be at most 65535, got %d", c.TLS.HTTPPort))
+	}
+	if c.TLS.Enabled() && c.TLS.HTTPPort == c.Server.Port {
+		errs = append(errs, "tls.http_port (TLS_HTTP_PORT) must differ from server.port (PORT)")
+	}
+
+	if c.Database.Path == "" && c.Database.URL == "" {
+		errs = append(errs, "either database.url (DATABASE_URL) or database.path (DB_PATH) must be set")
+	}
+
+	if len(c.Safety.Checkers) == 0 {
+		errs = append(errs, "safety.checkers (SAFETY_CHECKERS) must name at least one checker")
+	}
+	for _, checker := range c.Safety.Checkers {
+		switch checker {
+		case safebrowsing.CheckerGoogle:
+			if c.Safety.GoogleAPIKey == "" {
+				errs = append(errs, "safety.google_api_key (SAFE_BROWSING_API_KEY) must be set for the google checker")
+			}
+		case safebrowsing.CheckerBlocklist:
+			if c.Safety.BlocklistPath == "" {
+				errs = append(errs, "safety.blocklist_path (SAFETY_BLOCKLIST_PATH) must be set for the blocklist checker")
+			}
+		case safebrowsing.CheckerNoop:
+		default:
+			errs = append(errs, fmt.Sprintf("safety.checkers (SAFETY_CHECKERS) has unknown checker %q", checker))
+		}
+	}
+
+	if c.Keys.Strategy != keygen.StrategyRandom && c.Keys.Strategy != keygen.StrategyCounter {
+		errs = append(errs, fmt.Sprintf("keys.strategy (KEY_STRATEGY) must be either random or counter, got %q", c.Keys.Strategy))
+	}
+	maxLength := keygen.MaxLength
+	if c.Keys.Strategy == keygen.StrategyCounter {
+		maxLength = keygen.MaxCounterLength
+	}
+	if c.Keys.Length < keygen.MinLength || c.Keys.Length > maxLength {
+		errs = append(errs, fmt.Sprintf("keys.length (KEY_LENGTH) must be between %d and %d for the %s strategy, got %d", keygen.MinLength, maxLength, c.Keys.Strategy, c.Keys.Length))
+	}
+	if c.Expiry.Action != ExpiryMark && c.Expiry.Action != ExpiryPurge {
+		errs = append(errs, fmt.Sprintf("expiry.action (EXPIRED_LINKS) must be either mark or purge, got %q", c.Expiry.Action))
+	}
+	return errs
+}
+
+// Print writes every setting with its effective value and where it was set.
+// Secrets are redacted.
+func (c *Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tENV\tVALUE\tSOURCE")
+	for _, s := range c.settings() {
+		source := c.sources[s.key]
+		if source == "" {
+			source = "default"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.key, s.env, s.redacted(), source)
+	}
+	return tw.Flush()
+}
+
+// setting is a field of Config that holds a value.
+type setting struct {
+	key    string
+	env    string
+	help   string
+	secret string
+	min    string
+	value  reflect.Value
+}
+
+// settings lists the settings of c in the order they are declared.
+func (c *Config) settings() []setting {
+	var settings []setting
+	collectSettings(reflect.ValueOf(c).Elem(), "", &settings)
+	return settings
+}
+
+func collectSettings(v reflect.Value, prefix string, settings *[]setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, ok := field.Tag.Lookup("key")
+		if !ok {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			collectSettings(v.Field(i), key, settings)
+			continue
+		}
+		*settings = append(*settings, setting{
+			key:    key,
+			env:    field.Tag.Get("env"),
+			help:   field.Tag.Get("help"),
+			secret: field.Tag.Get("secret"),
+			min:    field.Tag.Get("min"),
+			value:  v.Field(i),
+		})
+	}
+}
+
+// String names the setting in errors.
+func (s setting) String() string {
+	return fmt.Sprintf("%s (%s)", s.key, s.env)
+}
+
+// set parses value into the setting.
+func (s setting) set(value string) error {
+	switch v := s.value.Addr().Interface().(type) {
+	case *string:
+		*v = value
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("must be a whole number, got %q", value)
+		}
+		*v = n
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", value)
+		}
+		*v = b
+	case *time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 10s, got %q", value)
+		}
+		*v = d
+	case *[]string:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*v = list
+	default:
+		panic(fmt.Sprintf("config: unsupported type %s of %s", s.value.Type(), s.key))
+	}
+	return nil
+}
+
+// get formats the value of the setting the way set parses it.
+func (s setting) get() string {
+	switch v := s.value.Interface().(type) {
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (s setting) redacted() string {
+	value := s.get()
+	if value == "" {
+		return ""
+	}
+	switch s.secret {
+	case "":
+		return value
+	case "password":
+		if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+			return u.Redacted()
+		}
+	}
+	return "xxxxx"
+}
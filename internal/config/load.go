@@ -0,0 +1,157 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Flags are the command line flags that override settings.
+type Flags struct {
+	set  *flag.FlagSet
+	file string
+}
+
+// RegisterFlags adds a -config flag naming the config file to set, and a flag
+// for every setting named after its key, such as -server.port.
+func RegisterFlags(set *flag.FlagSet) *Flags {
+	flags := &Flags{set: set}
+	set.StringVar(&flags.file, "config", "", "read settings from a YAML or TOML `file`; defaults to $CONFIG_FILE")
+	for _, s := range Default().settings() {
+		defaultValue := s.get()
+		if s.secret != "" {
+			defaultValue = ""
+		}
+		set.String(s.key, defaultValue, fmt.Sprintf("%s ($%s)", s.help, s.env))
+	}
+	return flags
+}
+
+// Load reads the configuration. Settings in the config file named by the
+// -config flag or CONFIG_FILE override the defaults, environment variables
+// override the file, and flags that were given override everything else.
+// Empty environment variables are ignored. flags may be nil.
+//
+// If any setting is invalid, the error is of type Errors and lists every
+// problem. The configuration is returned either way, with invalid values left
+// at the value of the previous layer.
+func Load(flags *Flags) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+	byKey := make(map[string]*setting, len(settings))
+	for i := range settings {
+		byKey[settings[i].key] = &settings[i]
+	}
+
+	var errs Errors
+	apply := func(s *setting, value, source string) {
+		if err := s.set(value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s from %s %v", s, source, err))
+			return
+		}
+		cfg.sources[s.key] = source
+	}
+
+	path := os.Getenv("CONFIG_FILE")
+	if flags != nil && flags.file != "" {
+		path = flags.file
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s, ok := byKey[key]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s has unknown setting %q", path, key))
+				continue
+			}
+			apply(s, values[key], path)
+		}
+	}
+
+	for i := range settings {
+		if value := os.Getenv(settings[i].env); value != "" {
+			apply(&settings[i], value, "$"+settings[i].env)
+		}
+	}
+
+	if flags != nil {
+		flags.set.Visit(func(f *flag.Flag) {
+			if s, ok := byKey[f.Name]; ok {
+				apply(s, f.Value.String(), "-"+f.Name)
+			}
+		})
+	}
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+	return cfg, nil
+}
+
+// readFile reads a YAML or TOML file, depending on its extension, into the
+// values of the settings it has by key. Lists become comma separated values
+// so that every layer is parsed the same way.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		_, err = toml.Decode(string(data), &doc)
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten(doc, "", values)
+	return values, nil
+}
+
+// flatten stores the scalars and lists in section under their dotted keys.
+func flatten(section map[string]interface{}, prefix string, values map[string]string) {
+	for name, value := range section {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flatten(value, key, values)
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/cache"
+)
+
+// CacheStats describes how well the key lookup cache is doing. Negative hits
+// are lookups of unknown keys that were answered without a query.
+type CacheStats struct {
+	Hits         int64
+	NegativeHits int64
+	Misses       int64
+	Size         int
+}
+
+// urlCache caches GetURL results by key. A nil entry records that the key
+// does not exist. Because a URL can be reached through its current key and
+// any of its old ones, the keys of each cached URL are indexed by ID so that
+// a change to the URL can drop all of them. A nil *urlCache caches nothing.
+type urlCache struct {
+	mu          sync.Mutex
+	lru         *cache.LRU[string, *URL]
+	keysByID    map[int64]map[string]struct{}
+	ttl         time.Duration
+	negativeTTL time.Duration
+	// generation changes on every invalidation, so that a lookup which raced
+	// with a write does not cache what it read before the write.
+	generation uint64
+
+	hits         atomic.Int64
+	negativeHits atomic.Int64
+	misses       atomic.Int64
+}
+
+func newURLCache(size int, ttl, negativeTTL time.Duration) *urlCache {
+	c := &urlCache{
+		lru:         cache.NewLRU[string, *URL](size),
+		keysByID:    make(map[int64]map[string]struct{}),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+	c.lru.OnEvict = c.unindex
+	return c
+}
+
+// get returns a copy of the cached URL for key. found is false when the key
+// has to be looked up, in which case the result should be passed to set
+// together with generation. url is nil when the key is known not to exist.
+func (c *urlCache) get(key string) (url *URL, found bool, generation uint64) {
+	if c == nil {
+		return nil, false, 0
+	}
+
+	c.mu.Lock()
+	cached, ok := c.lru.Get(key)
+	generation = c.generation
+	c.mu.Unlock()
+
+	switch {
+	case !ok:
+		c.misses.Add(1)
+		return nil, false, generation
+	case cached == nil:
+		c.negativeHits.Add(1)
+		return nil, true, generation
+	default:
+		c.hits.Add(1)
+		copied := *cached
+		return &copied, true, generation
+	}
+}
+
+func (c *urlCache) set(key string, url *URL, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if url == nil {
+		if c.negativeTTL > 0 {
+			c.lru.Set(key, nil, c.negativeTTL)
+		}
+		return
+	}
+
+	copied := *url
+	c.lru.Set(key, &copied, c.ttl)
+	keys, ok := c.keysByID[url.ID]
+	if !ok {
+		keys = make(map[string]struct{})
+		c.keysByID[url.ID] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+// unindex is called by the LRU with c.mu held.
+func (c *urlCache) unindex(key string, url *URL) {
+	if url == nil {
+		return
+	}
+	keys := c.keysByID[url.ID]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(c.keysByID, url.ID)
+	}
+}
+
+// invalidateKey drops key, which matters when a key that was cached as
+// missing starts to exist.
+func (c *urlCache) invalidateKey(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.lru.Delete(key)
+}
+
+// invalidateURL drops every key under which the URL with the given ID is
+// cached.
+func (c *urlCache) invalidateURL(id int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key := range c.keysByID[id] {
+		c.lru.Delete(key)
+	}
+}
+
+// invalidateLimited drops the URLs with the given IDs that have a click
+// limit, whose cached click counts would otherwise let them be followed
+// past it.
+func (c *urlCache) invalidateLimited(ids []int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, id := range ids {
+		for key := range c.keysByID[id] {
+			if url, ok := c.lru.Get(key); ok && url != nil && url.MaxClicks == 0 {
+				continue
+			}
+			c.lru.Delete(key)
+		}
+	}
+}
+
+func (c *urlCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.lru.Clear()
+}
+
+func (c *urlCache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		Size:         size,
+	}
+}
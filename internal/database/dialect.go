@@ -0,0 +1,125 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dialect holds what differs between the supported databases. Queries are
+// written with ? placeholders and in SQL both databases understand, and are
+// rebound for the database they run on.
+type dialect struct {
+	name string
+	// driver is the database/sql driver name.
+	driver string
+	// numberedPlaceholders means $1, $2, ... instead of ?.
+	numberedPlaceholders bool
+	// bucketExprs format clicked_at as the start of its hour or day, as
+	// "2006-01-02 15:04:05" in UTC.
+	bucketExprs map[string]string
+	// tableExistsQuery and columnExistsQuery count matching tables and
+	// columns, and take the table and column names as parameters.
+	tableExistsQuery  string
+	columnExistsQuery string
+	isUniqueViolation func(error) bool
+}
+
+var sqliteDialect = &dialect{
+	name:   "sqlite",
+	driver: "sqlite",
+	bucketExprs: map[string]string{
+		BucketHour: "strftime('%Y-%m-%d %H:00:00', clicked_at)",
+		BucketDay:  "strftime('%Y-%m-%d 00:00:00', clicked_at)",
+	},
+	tableExistsQuery:  "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?",
+	columnExistsQuery: "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?",
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	},
+}
+
+var postgresDialect = &dialect{
+	name:                 "postgres",
+	driver:               "postgres",
+	numberedPlaceholders: true,
+	bucketExprs: map[string]string{
+		BucketHour: "to_char(date_trunc('hour', clicked_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD HH24:MI:SS')",
+		BucketDay:  "to_char(date_trunc('day', clicked_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD HH24:MI:SS')",
+	},
+	tableExistsQuery:  "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?",
+	columnExistsQuery: "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?",
+	isUniqueViolation: func(err error) bool {
+		var pqErr *pq.Error
+		return errors.As(err, &pqErr) && pqErr.Code == "23505"
+	},
+}
+
+// rebind rewrites ? placeholders for the dialect. Queries must not contain
+// question marks anywhere else.
+func (d *dialect) rebind(query string) string {
+	if !d.numberedPlaceholders {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// txn is a transaction whose queries are rebound for the dialect.
+type txn struct {
+	*sql.Tx
+	dialect *dialect
+}
+
+func (tx *txn) exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+func (tx *txn) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *txn) queryRow(query string, args ...interface{}) *sql.Row {
+	return tx.QueryRow(tx.dialect.rebind(query), args...)
+}
+
+func (tx *txn) prepare(query string) (*sql.Stmt, error) {
+	return tx.Prepare(tx.dialect.rebind(query))
+}
+
+func (db *DB) begin() (*txn, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx, dialect: db.dialect}, nil
+}
+
+func (db *DB) exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.conn.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.conn.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) queryRow(query string, args ...interface{}) *sql.Row {
+	return db.conn.QueryRow(db.dialect.rebind(query), args...)
+}
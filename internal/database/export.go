@@ -0,0 +1,108 @@
+package database
+
+import "fmt"
+
+// exportBatchSize is how many rows the export functions read at a time.
+const exportBatchSize = 500
+
+// ExportURLs calls fn with every URL of a user, or of all users if userID is
+// zero, in ID order and with their tags. URLs are read in batches, so that
+// exports of any size use little memory and hold no query open while fn
+// runs. An error from fn stops the export and is returned.
+func (db *DB) ExportURLs(userID int64, fn func(*URL) error) error {
+	var afterID int64
+	for {
+		query := "SELECT " + urlColumns + " FROM urls WHERE id > ?"
+		args := []interface{}{afterID}
+		if userID != 0 {
+			query += " AND user_id = ?"
+			args = append(args, userID)
+		}
+		query += " ORDER BY id LIMIT ?"
+		args = append(args, exportBatchSize)
+
+		rows, err := db.query(query, args...)
+		if err != nil {
+			return fmt.Errorf("error querying URLs: %w", err)
+		}
+
+		var urls []URL
+		for rows.Next() {
+			url, err := scanURL(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning row: %w", err)
+			}
+			urls = append(urls, *url)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating rows: %w", err)
+		}
+
+		if err := db.loadTags(urls); err != nil {
+			return err
+		}
+
+		for i := range urls {
+			if err := fn(&urls[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(urls) < exportBatchSize {
+			return nil
+		}
+		afterID = urls[len(urls)-1].ID
+	}
+}
+
+// ExportClicks calls fn with every click on the URLs of a user, or on all
+// URLs if userID is zero, in the order they were recorded. Like ExportURLs it
+// reads the clicks in batches.
+func (db *DB) ExportClicks(userID int64, fn func(*Click) error) error {
+	var afterID int64
+	for {
+		query := "SELECT id, url_id, key, clicked_at, referrer, user_agent, ip_hash, accept_language FROM clicks WHERE id > ?"
+		args := []interface{}{afterID}
+		if userID != 0 {
+			query += " AND url_id IN (SELECT id FROM urls WHERE user_id = ?)"
+			args = append(args, userID)
+		}
+		query += " ORDER BY id LIMIT ?"
+		args = append(args, exportBatchSize)
+
+		rows, err := db.query(query, args...)
+		if err != nil {
+			return fmt.Errorf("error querying clicks: %w", err)
+		}
+
+		var clicks []Click
+		for rows.Next() {
+			var click Click
+			err := rows.Scan(&click.ID, &click.URLID, &click.Key, &click.ClickedAt, &click.Referrer, &click.UserAgent, &click.IPHash, &click.AcceptLanguage)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning row: %w", err)
+			}
+			clicks = append(clicks, click)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating rows: %w", err)
+		}
+
+		for i := range clicks {
+			if err := fn(&clicks[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(clicks) < exportBatchSize {
+			return nil
+		}
+		afterID = clicks[len(clicks)-1].ID
+	}
+}
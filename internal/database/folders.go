@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrFolderExists = errors.New("folder already exists")
+
+// Folder groups a user's URLs. A URL is in at most one folder.
+type Folder struct {
+	ID        int64
+	UserID    int64
+	Name      string
+	CreatedAt time.Time
+	// URLs is the number of URLs in the folder. It is only set by
+	// GetFoldersByUserID.
+	URLs int
+}
+
+func (db *DB) CreateFolder(userID int64, name string) (*Folder, error) {
+	var id int64
+	err := db.queryRow("INSERT INTO folders (user_id, name) VALUES (?, ?) RETURNING id", userID, name).Scan(&id)
+	if err != nil {
+		if db.dialect.isUniqueViolation(err) {
+			return nil, fmt.Errorf("error inserting folder: %w", ErrFolderExists)
+		}
+		return nil, fmt.Errorf("error inserting folder: %w", err)
+	}
+
+	return db.GetFolder(id)
+}
+
+// GetFolder returns the folder with the given ID, or nil if there is none.
+func (db *DB) GetFolder(id int64) (*Folder, error) {
+	var folder Folder
+	err := db.queryRow("SELECT id, user_id, name, created_at FROM folders WHERE id = ?", id).Scan(&folder.ID, &folder.UserID, &folder.Name, &folder.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error querying folder: %w", err)
+	}
+	return &folder, nil
+}
+
+// GetFoldersByUserID returns the user's folders by name, with the number of
+// URLs in each.
+func (db *DB) GetFoldersByUserID(userID int64) ([]Folder, error) {
+	rows, err := db.query(`SELECT folders.id, folders.user_id, folders.name, folders.created_at, COUNT(urls.id)
+		FROM folders LEFT JOIN urls ON urls.folder_id = folders.id
+		WHERE folders.user_id = ?
+		GROUP BY folders.id, folders.user_id, folders.name, folders.created_at
+		ORDER BY folders.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying folders: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []Folder
+	for rows.Next() {
+		var folder Folder
+		if err := rows.Scan(&folder.ID, &folder.UserID, &folder.Name, &folder.CreatedAt, &folder.URLs); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		folders = append(folders, folder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return folders, nil
+}
+
+func (db *DB) RenameFolder(id, userID int64, name string) error {
+	_, err := db.exec("UPDATE folders SET name = ? WHERE id = ? AND user_id = ?", name, id, userID)
+	if err != nil {
+		if db.dialect.isUniqueViolation(err) {
+			return fmt.Errorf("error renaming folder: %w", ErrFolderExists)
+		}
+		return fmt.Errorf("error renaming folder: %w", err)
+	}
+	return nil
+}
+
+// DeleteFolder deletes a folder. The URLs in it are kept and no longer belong
+// to any folder.
+func (db *DB) DeleteFolder(id, userID int64) error {
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.exec("UPDATE urls SET folder_id = NULL WHERE folder_id = ? AND user_id = ?", id, userID); err != nil {
+		return fmt.Errorf("error removing URLs from folder: %w", err)
+	}
+
+	if _, err := tx.exec("DELETE FROM folders WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		return fmt.Errorf("error deleting folder: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	// Cached URLs still point at the folder.
+	db.cache.clear()
+	return nil
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// Migration is one step of the schema history, loaded from
+// migrations/<dialect>/NNNN_name.sql. Both dialects use the same numbers
+// for the same change.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// legacyChecks detect which migrations a database created before
+// schema_migrations existed already has. initSchema used to create
+// everything with CREATE TABLE IF NOT EXISTS, so those databases have
+// whatever the binary that created them knew about.
+var legacyChecks = map[int]func(*txn) (bool, error){
+	1: tableExists("urls"),
+	2: columnExists("urls", "qr_code"),
+	3: tableExists("api_tokens"),
+	4: tableExists("url_aliases"),
+	5: columnExists("urls", "expires_at"),
+	6: tableExists("clicks"),
+}
+
+func loadMigrations(d *dialect) ([]Migration, error) {
+	dir := path.Join("migrations", d.name)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		version, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		n, err := strconv.Atoi(version)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", entry.Name())
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{Version: n, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version: %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrate brings the schema up to date and returns the migrations that were
+// applied. Each migration runs in its own transaction. With dryRun set
+// nothing is changed and the migrations that would be applied are returned.
+// Migrate refuses to touch a database that has migrations this binary does
+// not know about.
+func (db *DB) Migrate(dryRun bool) ([]Migration, error) {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations(migrations, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	for version := range applied {
+		if version > latest {
+			return nil, fmt.Errorf("%w: database is at version %d, latest known migration is %d", ErrSchemaTooNew, version, latest)
+		}
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	if dryRun {
+		return pending, nil
+	}
+
+	for i, migration := range pending {
+		if err := db.applyMigration(migration); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, nil
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations,
+// creating the table first if needed. A database from before migrations
+// existed is adopted by recording the migrations it already has.
+func (db *DB) appliedMigrations(migrations []Migration, dryRun bool) (map[int]bool, error) {
+	tx, err := db.begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hasTable, err := tableExists("schema_migrations")(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]bool)
+	if hasTable {
+		rows, err := tx.query("SELECT version FROM schema_migrations")
+		if err != nil {
+			return nil, fmt.Errorf("error querying migrations: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var version int
+			if err := rows.Scan(&version); err != nil {
+				return nil, fmt.Errorf("error scanning row: %w", err)
+			}
+			applied[version] = true
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating rows: %w", err)
+		}
+		return applied, nil
+	}
+
+	for _, migration := range migrations {
+		check, ok := legacyChecks[migration.Version]
+		if !ok {
+			continue
+		}
+		exists, err := check(tx)
+		if err != nil {
+			return nil, err
+		}
+		applied[migration.Version] = exists
+	}
+
+	if dryRun {
+		return applied, nil
+	}
+
+	_, err = tx.exec(`CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			continue
+		}
+		if _, err := tx.exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name); err != nil {
+			return nil, fmt.Errorf("error recording migration %s: %w", migration, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return applied, nil
+}
+
+func (db *DB) applyMigration(migration Migration) error {
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return fmt.Errorf("error applying migration %s: %w", migration, err)
+	}
+
+	if _, err := tx.exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name); err != nil {
+		return fmt.Errorf("error recording migration %s: %w", migration, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing migration %s: %w", migration, err)
+	}
+	return nil
+}
+
+func tableExists(table string) func(*txn) (bool, error) {
+	return func(tx *txn) (bool, error) {
+		var n int
+		err := tx.queryRow(tx.dialect.tableExistsQuery, table).Scan(&n)
+		if err != nil {
+			return false, fmt.Errorf("error checking for table %s: %w", table, err)
+		}
+		return n > 0, nil
+	}
+}
+
+func columnExists(table, column string) func(*txn) (bool, error) {
+	return func(tx *txn) (bool, error) {
+		var n int
+		err := tx.queryRow(tx.dialect.columnExistsQuery, table, column).Scan(&n)
+		if err != nil {
+			return false, fmt.Errorf("error checking for column %s.%s: %w", table, column, err)
+		}
+		return n > 0, nil
+	}
+}
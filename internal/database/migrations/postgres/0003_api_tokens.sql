@@ -0,0 +1,9 @@
+CREATE TABLE api_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	scope TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMPTZ
+);
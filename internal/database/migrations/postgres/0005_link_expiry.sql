@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN expires_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN expired BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,12 @@
+CREATE TABLE clicks (
+	id BIGSERIAL PRIMARY KEY,
+	url_id BIGINT NOT NULL REFERENCES urls(id),
+	key TEXT NOT NULL,
+	clicked_at TIMESTAMPTZ NOT NULL,
+	referrer TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_hash TEXT NOT NULL DEFAULT '',
+	accept_language TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_clicks_url_id_clicked_at ON clicks (url_id, clicked_at);
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE urls ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- admin_id is NULL for actions taken automatically. target_label keeps the
+-- username or key of the target, which may since have been deleted.
+CREATE TABLE moderation_actions (
+	id BIGSERIAL PRIMARY KEY,
+	admin_id BIGINT REFERENCES users(id),
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id BIGINT NOT NULL,
+	target_label TEXT NOT NULL DEFAULT '',
+	reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_moderation_actions_created_at ON moderation_actions (created_at);
@@ -0,0 +1,26 @@
+CREATE TABLE folders (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, name)
+);
+
+ALTER TABLE urls ADD COLUMN folder_id BIGINT REFERENCES folders(id);
+
+CREATE INDEX idx_urls_folder_id ON urls (folder_id);
+
+CREATE TABLE tags (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	UNIQUE (user_id, name)
+);
+
+CREATE TABLE url_tags (
+	url_id BIGINT NOT NULL REFERENCES urls(id),
+	tag_id BIGINT NOT NULL REFERENCES tags(id),
+	PRIMARY KEY (url_id, tag_id)
+);
+
+CREATE INDEX idx_url_tags_tag_id ON url_tags (tag_id);
@@ -0,0 +1,2 @@
+-- QR codes are stored as base64 encoded PNG images.
+ALTER TABLE urls ADD COLUMN qr_code TEXT;
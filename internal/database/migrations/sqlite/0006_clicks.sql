@@ -0,0 +1,13 @@
+CREATE TABLE clicks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url_id INTEGER NOT NULL,
+	key TEXT NOT NULL,
+	clicked_at TIMESTAMP NOT NULL,
+	referrer TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_hash TEXT NOT NULL DEFAULT '',
+	accept_language TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (url_id) REFERENCES urls(id)
+);
+
+CREATE INDEX idx_clicks_url_id_clicked_at ON clicks (url_id, clicked_at);
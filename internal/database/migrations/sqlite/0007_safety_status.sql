@@ -0,0 +1,5 @@
+-- safety_status is one of unchecked, safe or flagged. safety_threat holds the
+-- threat types reported for flagged links.
+ALTER TABLE urls ADD COLUMN safety_status TEXT NOT NULL DEFAULT 'unchecked';
+ALTER TABLE urls ADD COLUMN safety_threat TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN last_checked_at TIMESTAMP;
@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT 0;
+
+-- admin_id is NULL for actions taken automatically. target_label keeps the
+-- username or key of the target, which may since have been deleted.
+CREATE TABLE moderation_actions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	admin_id INTEGER,
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id INTEGER NOT NULL,
+	target_label TEXT NOT NULL DEFAULT '',
+	reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (admin_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_moderation_actions_created_at ON moderation_actions (created_at);
@@ -0,0 +1,16 @@
+-- reporter_hash is the salted hash of the reporter's IP address, so that
+-- repeated reports from one visitor count once. Reports are resolved when an
+-- admin acts on the link.
+CREATE TABLE abuse_reports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url_id INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	details TEXT NOT NULL DEFAULT '',
+	contact TEXT NOT NULL DEFAULT '',
+	reporter_hash TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	resolved_at TIMESTAMP,
+	FOREIGN KEY (url_id) REFERENCES urls(id)
+);
+
+CREATE INDEX idx_abuse_reports_url_id ON abuse_reports (url_id);
@@ -0,0 +1,30 @@
+CREATE TABLE folders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, name),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+ALTER TABLE urls ADD COLUMN folder_id INTEGER REFERENCES folders(id);
+
+CREATE INDEX idx_urls_folder_id ON urls (folder_id);
+
+CREATE TABLE tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	UNIQUE (user_id, name),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE url_tags (
+	url_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (url_id, tag_id),
+	FOREIGN KEY (url_id) REFERENCES urls(id),
+	FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE INDEX idx_url_tags_tag_id ON url_tags (tag_id);
@@ -0,0 +1,11 @@
+-- title is an optional label shown on the dashboard and matched by search.
+-- last_clicked_at is kept up to date by RecordClicks so that links can be
+-- sorted by their most recent click.
+ALTER TABLE urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN last_clicked_at TIMESTAMP;
+
+UPDATE urls SET last_clicked_at = (SELECT MAX(clicked_at) FROM clicks WHERE clicks.url_id = urls.id);
+
+CREATE INDEX idx_urls_user_id_created_at ON urls (user_id, created_at, id);
+CREATE INDEX idx_urls_user_id_clicks ON urls (user_id, clicks, id);
+CREATE INDEX idx_urls_user_id_last_clicked_at ON urls (user_id, last_clicked_at, id);
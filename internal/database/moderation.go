@@ -0,0 +1,329 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ModerationDisableUser = "disable_user"
+	ModerationEnableUser  = "enable_user"
+	ModerationDisableURL  = "disable_url"
+	ModerationEnableURL   = "enable_url"
+	ModerationDeleteURL   = "delete_url"
+	// ModerationDismissReports resolves a link's abuse reports without
+	// changing the link.
+	ModerationDismissReports = "dismiss_reports"
+)
+
+const (
+	TargetUser = "user"
+	TargetURL  = "url"
+)
+
+// Filters for SearchURLs.
+const (
+	URLFilterAll      = ""
+	URLFilterFlagged  = "flagged"
+	URLFilterDisabled = "disabled"
+	// URLFilterReported lists links with unresolved abuse reports.
+	URLFilterReported = "reported"
+)
+
+// ModerationAction is an entry in the audit trail of moderation actions.
+type ModerationAction struct {
+	ID int64
+	// AdminID is zero for actions that were taken automatically.
+	AdminID       int64
+	AdminUsername string
+	Action        string
+	TargetType    string
+	TargetID      int64
+	TargetLabel   string
+	Reason        string
+	CreatedAt     time.Time
+}
+
+type URLWithOwner struct {
+	URL
+	Owner string
+	// Reports is the number of unresolved abuse reports.
+	Reports int
+}
+
+// SetUserAdmin grants or revokes the admin role and reports whether the user
+// exists.
+func (db *DB) SetUserAdmin(username string, isAdmin bool) (bool, error) {
+	result, err := db.exec("UPDATE users SET is_admin = ? WHERE username = ?", isAdmin, username)
+	if err != nil {
+		return false, fmt.Errorf("error updating user: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	return updated > 0, nil
+}
+
+// SearchUsers returns users whose username or email contains query, ordered
+// by ID.
+func (db *DB) SearchUsers(query string, limit, offset int) ([]User, error) {
+	pattern := likePattern(query)
+	rows, err := db.query("SELECT "+userColumns+" FROM users WHERE LOWER(username) LIKE ? ESCAPE '\\' OR LOWER(email) LIKE ? ESCAPE '\\' ORDER BY id LIMIT ? OFFSET ?",
+		pattern, pattern, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		users = append(users, *user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// SearchURLs returns the URLs of all users whose destination, key or owner
+// contains query, newest first. filter is one of the URLFilter constants.
+func (db *DB) SearchURLs(query, filter string, limit, offset int) ([]URLWithOwner, error) {
+	var condition string
+	switch filter {
+	case URLFilterAll:
+	case URLFilterFlagged:
+		condition = " AND safety_status = '" + SafetyFlagged + "'"
+	case URLFilterDisabled:
+		condition = " AND disabled = TRUE"
+	case URLFilterReported:
+		condition = " AND id IN (SELECT url_id FROM abuse_reports WHERE resolved_at IS NULL)"
+	default:
+		return nil, fmt.Errorf("unknown URL filter: %s", filter)
+	}
+
+	pattern := likePattern(query)
+	rows, err := db.query("SELECT "+urlColumns+", (SELECT username FROM users WHERE users.id = urls.user_id),"+
+		" (SELECT COUNT(*) FROM abuse_reports WHERE abuse_reports.url_id = urls.id AND resolved_at IS NULL) FROM urls"+
+		" WHERE (LOWER(url) LIKE ? ESCAPE '\\' OR LOWER(key) LIKE ? ESCAPE '\\' OR user_id IN (SELECT id FROM users WHERE LOWER(username) LIKE ? ESCAPE '\\'))"+condition+
+		" ORDER BY id DESC LIMIT ? OFFSET ?",
+		pattern, pattern, pattern, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error querying URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []URLWithOwner
+	for rows.Next() {
+		var owner string
+		var reports int
+		url, err := scanURL(extraScanner{rows, []interface{}{&owner, &reports}})
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		urls = append(urls, URLWithOwner{URL: *url, Owner: owner, Reports: reports})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return urls, nil
+}
+
+// extraScanner scans columns that follow the ones scanURL knows about.
+type extraScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// SetUserDisabled disables or enables a user on behalf of an admin. Disabling
+// a user can also disable all of their URLs; enabling a user leaves their
+// URLs as they are.
+func (db *DB) SetUserDisabled(adminID, userID int64, disabled, includeURLs bool, reason string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var username string
+	if err := tx.queryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no user found for id: %d", userID)
+		}
+		return fmt.Errorf("error querying user: %w", err)
+	}
+
+	if _, err := tx.exec("UPDATE users SET disabled = ? WHERE id = ?", disabled, userID); err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+
+	action := ModerationEnableUser
+	if disabled {
+		action = ModerationDisableUser
+		if includeURLs {
+			if _, err := tx.exec("UPDATE urls SET disabled = TRUE WHERE user_id = ?", userID); err != nil {
+				return fmt.Errorf("error disabling URLs: %w", err)
+			}
+			reason = strings.TrimSpace(reason + " (links disabled)")
+		}
+	}
+
+	if err := recordModerationAction(tx, adminID, action, TargetUser, userID, username, reason); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	if includeURLs {
+		db.cache.clear()
+	}
+	return nil
+}
+
+// SetURLDisabled disables or enables a URL. adminID is zero when the change
+// is made automatically. Changes made by an admin resolve the URL's abuse
+// reports.
+func (db *DB) SetURLDisabled(adminID, urlID int64, disabled bool, reason string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setURLDisabled(tx, adminID, urlID, disabled, reason); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	db.cache.invalidateURL(urlID)
+	return nil
+}
+
+func setURLDisabled(tx *txn, adminID, urlID int64, disabled bool, reason string) error {
+	key, err := urlKey(tx, urlID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.exec("UPDATE urls SET disabled = ? WHERE id = ?", disabled, urlID); err != nil {
+		return fmt.Errorf("error updating URL: %w", err)
+	}
+
+	if adminID != 0 {
+		if err := resolveAbuseReports(tx, urlID); err != nil {
+			return err
+		}
+	}
+
+	action := ModerationEnableURL
+	if disabled {
+		action = ModerationDisableURL
+	}
+	return recordModerationAction(tx, adminID, action, TargetURL, urlID, key, reason)
+}
+
+// ModerateDeleteURL deletes a URL on behalf of an admin and records it.
+func (db *DB) ModerateDeleteURL(adminID, urlID int64, reason string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	key, err := urlKey(tx, urlID)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteURL(tx, urlID); err != nil {
+		return err
+	}
+
+	if err := recordModerationAction(tx, adminID, ModerationDeleteURL, TargetURL, urlID, key, reason); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	db.cache.invalidateURL(urlID)
+	return nil
+}
+
+// GetModerationActions returns the audit trail, newest first.
+func (db *DB) GetModerationActions(limit, offset int) ([]ModerationAction, error) {
+	rows, err := db.query(`SELECT m.id, COALESCE(m.admin_id, 0), COALESCE(u.username, ''), m.action, m.target_type, m.target_id, m.target_label, m.reason, m.created_at
+		FROM moderation_actions m LEFT JOIN users u ON u.id = m.admin_id
+		ORDER BY m.created_at DESC, m.id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error querying moderation actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []ModerationAction
+	for rows.Next() {
+		var action ModerationAction
+		err := rows.Scan(&action.ID, &action.AdminID, &action.AdminUsername, &action.Action, &action.TargetType, &action.TargetID,
+			&action.TargetLabel, &action.Reason, &action.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		actions = append(actions, action)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return actions, nil
+}
+
+func recordModerationAction(tx *txn, adminID int64, action, targetType string, targetID int64, targetLabel, reason string) error {
+	var admin sql.NullInt64
+	if adminID != 0 {
+		admin = sql.NullInt64{Int64: adminID, Valid: true}
+	}
+
+	_, err := tx.exec("INSERT INTO moderation_actions (admin_id, action, target_type, target_id, target_label, reason) VALUES (?, ?, ?, ?, ?, ?)",
+		admin, action, targetType, targetID, targetLabel, reason)
+	if err != nil {
+		return fmt.Errorf("error recording moderation action: %w", err)
+	}
+	return nil
+}
+
+func urlKey(tx *txn, urlID int64) (string, error) {
+	var key string
+	if err := tx.queryRow("SELECT key FROM urls WHERE id = ?", urlID).Scan(&key); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w for id: %d", ErrURLNotFound, urlID)
+		}
+		return "", fmt.Errorf("error querying URL: %w", err)
+	}
+	return key, nil
+}
+
+// likePattern matches values that contain s, ignoring case. It is used with
+// ESCAPE '\'.
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(s))
+	return "%" + s + "%"
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AbuseReport is a visitor's report that a short URL is being abused.
+type AbuseReport struct {
+	ID      int64
+	URLID   int64
+	Reason  string
+	Details string
+	Contact string
+	// ReporterHash identifies the reporter without storing their IP address.
+	ReporterHash string
+	CreatedAt    time.Time
+	ResolvedAt   *time.Time
+}
+
+// CreateAbuseReport stores a report. Once threshold distinct reporters have
+// unresolved reports against a URL it is disabled, which is recorded as an
+// automatic moderation action; a threshold of zero never disables URLs. It
+// reports whether the URL was disabled by this report.
+func (db *DB) CreateAbuseReport(report *AbuseReport, threshold int) (bool, error) {
+	tx, err := db.begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var disabled bool
+	if err := tx.queryRow("SELECT disabled FROM urls WHERE id = ?", report.URLID).Scan(&disabled); err != nil {
+		if err == sql.ErrNoRows {
+			return false, fmt.Errorf("%w for id: %d", ErrURLNotFound, report.URLID)
+		}
+		return false, fmt.Errorf("error querying URL: %w", err)
+	}
+
+	_, err = tx.exec("INSERT INTO abuse_reports (url_id, reason, details, contact, reporter_hash) VALUES (?, ?, ?, ?, ?)",
+		report.URLID, report.Reason, report.Details, report.Contact, report.ReporterHash)
+	if err != nil {
+		return false, fmt.Errorf("error inserting abuse report: %w", err)
+	}
+
+	autoDisabled := false
+	if !disabled && threshold > 0 {
+		var reporters int
+		err := tx.queryRow("SELECT COUNT(DISTINCT reporter_hash) FROM abuse_reports WHERE url_id = ? AND resolved_at IS NULL", report.URLID).Scan(&reporters)
+		if err != nil {
+			return false, fmt.Errorf("error counting abuse reports: %w", err)
+		}
+
+		if reporters >= threshold {
+			if err := setURLDisabled(tx, 0, report.URLID, true, fmt.Sprintf("%d abuse reports", reporters)); err != nil {
+				return false, err
+			}
+			autoDisabled = true
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+	if autoDisabled {
+		db.cache.invalidateURL(report.URLID)
+	}
+	return autoDisabled, nil
+}
+
+// GetAbuseReports returns all reports against a URL, newest first.
+func (db *DB) GetAbuseReports(urlID int64) ([]AbuseReport, error) {
+	rows, err := db.query("SELECT id, url_id, reason, details, contact, reporter_hash, created_at, resolved_at FROM abuse_reports WHERE url_id = ? ORDER BY created_at DESC, id DESC", urlID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying abuse reports: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []AbuseReport
+	for rows.Next() {
+		var report AbuseReport
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&report.ID, &report.URLID, &report.Reason, &report.Details, &report.Contact, &report.ReporterHash, &report.CreatedAt, &resolvedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if resolvedAt.Valid {
+			report.ResolvedAt = &resolvedAt.Time
+		}
+		reports = append(reports, report)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return reports, nil
+}
+
+// DismissAbuseReports resolves the reports against a URL on behalf of an
+// admin without changing the URL.
+func (db *DB) DismissAbuseReports(adminID, urlID int64, reason string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	key, err := urlKey(tx, urlID)
+	if err != nil {
+		return err
+	}
+
+	if err := resolveAbuseReports(tx, urlID); err != nil {
+		return err
+	}
+
+	if err := recordModerationAction(tx, adminID, ModerationDismissReports, TargetURL, urlID, key, reason); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+func resolveAbuseReports(tx *txn, urlID int64) error {
+	if _, err := tx.exec("UPDATE abuse_reports SET resolved_at = CURRENT_TIMESTAMP WHERE url_id = ? AND resolved_at IS NULL", urlID); err != nil {
+		return fmt.Errorf("error resolving abuse reports: %w", err)
+	}
+	return nil
+}
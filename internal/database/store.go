@@ -0,0 +1,59 @@
+package database
+
+import "time"
+
+// Store is the persistence the application needs. DB implements it on top
+// of SQLite or PostgreSQL.
+type Store interface {
+	CreateUser(username, email, password string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	GetUserByID(id int64) (*User, error)
+	SearchUsers(query string, limit, offset int) ([]User, error)
+	SetUserDisabled(adminID, userID int64, disabled, includeURLs bool, reason string) error
+
+	InsertURL(url *URL) (*URL, error)
+	InsertURLs(urls []*URL) ([]*URL, error)
+	GetURL(key string) (*URL, error)
+	GetURLByID(id int64) (*URL, error)
+	ListURLs(q URLQuery) (*URLPage, error)
+	UpdateURL(url *URL, newKey string) error
+	UpdateQRCode(id int64, qrCode string) error
+	RenameURLKey(id int64, newKey string) error
+	GetAliasesByURLID(urlID int64) ([]string, error)
+	DeleteURL(id int64) error
+	SearchURLs(query, filter string, limit, offset int) ([]URLWithOwner, error)
+	SetURLDisabled(adminID, urlID int64, disabled bool, reason string) error
+	ModerateDeleteURL(adminID, urlID int64, reason string) error
+	GetModerationActions(limit, offset int) ([]ModerationAction, error)
+	CreateAbuseReport(report *AbuseReport, threshold int) (bool, error)
+	GetAbuseReports(urlID int64) ([]AbuseReport, error)
+	DismissAbuseReports(adminID, urlID int64, reason string) error
+	SetURLTags(urlID, userID int64, tags []string) error
+	GetTagsByUserID(userID int64) ([]Tag, error)
+	CreateFolder(userID int64, name string) (*Folder, error)
+	GetFolder(id int64) (*Folder, error)
+	GetFoldersByUserID(userID int64) ([]Folder, error)
+	RenameFolder(id, userID int64, name string) error
+	DeleteFolder(id, userID int64) error
+
+	GetURLsForSafetyCheck(afterID int64, checkedBefore time.Time, limit int) ([]URL, error)
+	UpdateSafetyStatus(id int64, checkedURL, status, threat string, checkedAt time.Time) (bool, error)
+	MarkExpiredURLs(now time.Time) (int64, error)
+	PurgeExpiredURLs(now time.Time) (int64, error)
+
+	RecordClicks(clicks []*Click) error
+	RecordLimitedClick(click *Click) (bool, error)
+	GetClickBuckets(urlID int64, bucket string, since time.Time) ([]ClickBucket, error)
+
+	ExportURLs(userID int64, fn func(*URL) error) error
+	ExportClicks(userID int64, fn func(*Click) error) error
+
+	CreateAPIToken(userID int64, name, tokenHash, scope string) (*APIToken, error)
+	GetAPITokenByID(id int64) (*APIToken, error)
+	GetAPITokenByHash(tokenHash string) (*APIToken, error)
+	GetAPITokensByUserID(userID int64) ([]APIToken, error)
+	TouchAPIToken(id int64) error
+	DeleteAPIToken(id, userID int64) error
+}
+
+var _ Store = (*DB)(nil)
@@ -0,0 +1,667 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// forEachDialect runs test against a freshly migrated SQLite database and,
+// when TEST_DATABASE_URL points at a PostgreSQL server, against a freshly
+// migrated schema on that server.
+func forEachDialect(t *testing.T, test func(t *testing.T, db *DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, openTestSQLite(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, openTestPostgres(t))
+	})
+}
+
+func openTestSQLite(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// openTestPostgres creates a schema of its own for the test, so that tests
+// can share a server and start from an empty database.
+func openTestPostgres(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("error dropping schema %s: %v", schema, err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL must be a postgres:// URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	db, err := OpenPostgres(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createTestUser(t *testing.T, db *DB, username string) *User {
+	t.Helper()
+	user, err := db.CreateUser(username, username+"@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func insertTestURL(t *testing.T, db *DB, url *URL) *URL {
+	t.Helper()
+	inserted, err := db.InsertURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inserted
+}
+
+func TestMigrate(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		migrations, err := loadMigrations(db.dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) == 0 {
+			t.Fatal("no migrations found")
+		}
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Errorf("migration %s should be version %d", migration, i+1)
+			}
+		}
+
+		var applied int
+		if err := db.queryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+			t.Fatal(err)
+		}
+		if applied != len(migrations) {
+			t.Errorf("%d migrations were recorded, want %d", applied, len(migrations))
+		}
+
+		for _, dryRun := range []bool{true, false} {
+			pending, err := db.Migrate(dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != 0 {
+				t.Errorf("Migrate(%v) on an up to date database returned %v", dryRun, pending)
+			}
+		}
+
+		latest := migrations[len(migrations)-1].Version
+		if _, err := db.exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", latest+1, "future"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Migrate(false); !errors.Is(err, ErrSchemaTooNew) {
+			t.Errorf("Migrate on a newer schema returned %v, want ErrSchemaTooNew", err)
+		}
+	})
+}
+
+func TestInsertURL(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+
+		custom := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/a", Key: "custom", Title: "A", Tags: []string{"work", "docs"}})
+		if custom.ID == 0 || custom.Key != "custom" || custom.Title != "A" {
+			t.Errorf("got %+v", custom)
+		}
+		if custom.SafetyStatus != SafetyUnchecked {
+			t.Errorf("got safety status %q, want %q", custom.SafetyStatus, SafetyUnchecked)
+		}
+		if want := []string{"docs", "work"}; !reflect.DeepEqual(custom.Tags, want) {
+			t.Errorf("got tags %v, want %v", custom.Tags, want)
+		}
+
+		generated := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/b", Tags: []string{"work"}})
+		if generated.Key == "" || generated.ID == custom.ID {
+			t.Errorf("got %+v", generated)
+		}
+
+		if _, err := db.InsertURL(&URL{UserID: user.ID, URL: "https://example.com/c", Key: "custom"}); !errors.Is(err, ErrKeyTaken) {
+			t.Errorf("inserting a taken key returned %v, want ErrKeyTaken", err)
+		}
+
+		createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		imported := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/d", Key: "imported", CreatedAt: createdAt, Clicks: 42})
+		if !imported.CreatedAt.Equal(createdAt) || imported.Clicks != 42 {
+			t.Errorf("imported URL has created_at %v and %d clicks, want %v and 42", imported.CreatedAt, imported.Clicks, createdAt)
+		}
+
+		found, err := db.GetURL("custom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.ID != custom.ID {
+			t.Errorf("GetURL returned URL %d, want %d", found.ID, custom.ID)
+		}
+		if _, err := db.GetURL("missing"); !errors.Is(err, ErrURLNotFound) {
+			t.Errorf("GetURL of a missing key returned %v, want ErrURLNotFound", err)
+		}
+
+		tags, err := db.GetTagsByUserID(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []Tag{{Name: "docs", URLs: 1}, {Name: "work", URLs: 2}}; !reflect.DeepEqual(tags, want) {
+			t.Errorf("got tags %v, want %v", tags, want)
+		}
+	})
+}
+
+func TestInsertURLs(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+		insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/taken", Key: "taken"})
+
+		_, err := db.InsertURLs([]*URL{
+			{UserID: user.ID, URL: "https://example.com/1", Key: "one"},
+			{UserID: user.ID, URL: "https://example.com/2", Key: "taken"},
+		})
+		if !errors.Is(err, ErrKeyTaken) {
+			t.Fatalf("inserting a taken key returned %v, want ErrKeyTaken", err)
+		}
+		if _, err := db.GetURL("one"); !errors.Is(err, ErrURLNotFound) {
+			t.Errorf("a failed batch left URL one behind: %v", err)
+		}
+
+		inserted, err := db.InsertURLs([]*URL{
+			{UserID: user.ID, URL: "https://example.com/1", Key: "one"},
+			{UserID: user.ID, URL: "https://example.com/2"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(inserted) != 2 || inserted[0].Key != "one" || inserted[1].Key == "" {
+			t.Errorf("got %+v", inserted)
+		}
+	})
+}
+
+func TestRenameURLKey(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+		a := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/a", Key: "a"})
+		b := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/b", Key: "b"})
+
+		if err := db.RenameURLKey(a.ID, "a2"); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"a", "a2"} {
+			url, err := db.GetURL(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url.ID != a.ID || url.Key != "a2" {
+				t.Errorf("GetURL(%q) returned %d with key %q, want %d with key a2", key, url.ID, url.Key, a.ID)
+			}
+		}
+
+		if err := db.RenameURLKey(b.ID, "a"); !errors.Is(err, ErrKeyTaken) {
+			t.Errorf("renaming to another URL's old key returned %v, want ErrKeyTaken", err)
+		}
+		if err := db.RenameURLKey(b.ID, "a2"); !errors.Is(err, ErrKeyTaken) {
+			t.Errorf("renaming to another URL's key returned %v, want ErrKeyTaken", err)
+		}
+		if _, err := db.InsertURL(&URL{UserID: user.ID, URL: "https://example.com/c", Key: "a"}); !errors.Is(err, ErrKeyTaken) {
+			t.Errorf("inserting an old key returned %v, want ErrKeyTaken", err)
+		}
+
+		// Renaming back to an old key turns the current key into an alias.
+		if err := db.RenameURLKey(a.ID, "a"); err != nil {
+			t.Fatal(err)
+		}
+		aliases, err := db.GetAliasesByURLID(a.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a2"}; !reflect.DeepEqual(aliases, want) {
+			t.Errorf("got aliases %v, want %v", aliases, want)
+		}
+
+		if err := db.RenameURLKey(a.ID+b.ID+1, "x"); !errors.Is(err, ErrURLNotFound) {
+			t.Errorf("renaming a missing URL returned %v, want ErrURLNotFound", err)
+		}
+	})
+}
+
+func TestUpdateURL(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+		url := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/a", Key: "a", Tags: []string{"old"}})
+		insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/b", Key: "b"})
+
+		url.URL = "https://example.com/changed"
+		url.Tags = []string{"new"}
+		if err := db.UpdateURL(url, "b"); !errors.Is(err, ErrKeyTaken) {
+			t.Fatalf("renaming to a taken key returned %v, want ErrKeyTaken", err)
+		}
+		unchanged, err := db.GetURLByID(url.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unchanged.URL != "https://example.com/a" || !reflect.DeepEqual(unchanged.Tags, []string{"old"}) || unchanged.Key != "a" {
+			t.Errorf("a failed update changed the URL to %+v", unchanged)
+		}
+
+		if err := db.UpdateURL(url, "c"); err != nil {
+			t.Fatal(err)
+		}
+		updated, err := db.GetURL("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.ID != url.ID || updated.URL != "https://example.com/changed" {
+			t.Errorf("old key resolves to %+v", updated)
+		}
+		updated, err = db.GetURLByID(url.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Key != "c" || !reflect.DeepEqual(updated.Tags, []string{"new"}) {
+			t.Errorf("got key %q and tags %v, want c and [new]", updated.Key, updated.Tags)
+		}
+	})
+}
+
+func TestListURLs(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+		other := createTestUser(t, db, "bob")
+
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		var ids []int64
+		for i, clicks := range []int{3, 1, 3, 0, 2} {
+			url := insertTestURL(t, db, &URL{
+				UserID:    user.ID,
+				URL:       fmt.Sprintf("https://example.com/%d", i),
+				Key:       fmt.Sprintf("key%d", i),
+				CreatedAt: base.Add(time.Duration(i) * time.Hour),
+				Clicks:    clicks,
+			})
+			ids = append(ids, url.ID)
+		}
+		insertTestURL(t, db, &URL{UserID: other.ID, URL: "https://example.com/other", Key: "other"})
+
+		// URLs 1 and 3 were clicked; the others come last when sorting by
+		// the most recent click.
+		now := time.Now().UTC().Truncate(time.Second)
+		err := db.RecordClicks([]*Click{
+			{URLID: ids[1], Key: "key1", ClickedAt: now.Add(-time.Hour)},
+			{URLID: ids[3], Key: "key3", ClickedAt: now},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name string
+			q    URLQuery
+			want []int64
+		}{
+			{"newest first", URLQuery{}, []int64{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+			{"most recently clicked first", URLQuery{Sort: SortLastClick}, []int64{ids[3], ids[1], ids[4], ids[2], ids[0]}},
+			{"least recently clicked first", URLQuery{Sort: SortLastClick, Ascending: true}, []int64{ids[0], ids[2], ids[4], ids[1], ids[3]}},
+			{"oldest first", URLQuery{Ascending: true}, []int64{ids[0], ids[1], ids[2], ids[3], ids[4]}},
+			{"most clicked first", URLQuery{Sort: SortClicks}, []int64{ids[2], ids[0], ids[4], ids[1], ids[3]}},
+			{"least clicked first", URLQuery{Sort: SortClicks, Ascending: true}, []int64{ids[3], ids[1], ids[4], ids[0], ids[2]}},
+		}
+		for _, tt := range tests {
+			for _, limit := range []int{0, 1, 2, 5} {
+				tt.q.UserID = user.ID
+				tt.q.Limit = limit
+				got, err := listAllURLs(db, tt.q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s with limit %d: got %v, want %v", tt.name, limit, got, tt.want)
+				}
+			}
+		}
+
+		first, err := db.ListURLs(URLQuery{UserID: user.ID, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cursor := range []string{"not a cursor", encodeCursor(SortClicks, "3", ids[0]), encodeCursor(SortCreated, "2024-01-01", 0)} {
+			if _, err := db.ListURLs(URLQuery{UserID: user.ID, After: cursor}); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("listing after cursor %q returned %v, want ErrInvalidCursor", cursor, err)
+			}
+		}
+
+		// Deleting the last URL of a page neither invalidates its cursor
+		// nor shifts the next page.
+		if err := db.DeleteURL(ids[3]); err != nil {
+			t.Fatal(err)
+		}
+		second, err := db.ListURLs(URLQuery{UserID: user.ID, Limit: 2, After: first.Next})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(second.URLs) != 2 || second.URLs[0].ID != ids[2] || second.URLs[1].ID != ids[1] {
+			t.Errorf("second page after deleting a URL has %v, want %d and %d", second.URLs, ids[2], ids[1])
+		}
+	})
+}
+
+func TestListURLsFilters(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+		folder, err := db.CreateFolder(user.ID, "Folder")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		percent := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/100%25", Key: "percent", Title: "100% Sale", Tags: []string{"shop"}})
+		underscore := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/a_b", Key: "under_score", FolderID: folder.ID})
+		flagged := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/bad", Key: "bad", SafetyStatus: SafetyFlagged, Tags: []string{"shop"}})
+		renamed := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/renamed", Key: "OldName"})
+		if err := db.RenameURLKey(renamed.ID, "new"); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name string
+			q    URLQuery
+			want []int64
+		}{
+			{"percent sign", URLQuery{Search: "100%"}, []int64{percent.ID}},
+			{"underscore", URLQuery{Search: "_"}, []int64{underscore.ID}},
+			{"title ignoring case", URLQuery{Search: "sALE"}, []int64{percent.ID}},
+			{"old key", URLQuery{Search: "oldname"}, []int64{renamed.ID}},
+			{"folder", URLQuery{FolderID: folder.ID}, []int64{underscore.ID}},
+			{"tag", URLQuery{Tag: "shop"}, []int64{flagged.ID, percent.ID}},
+			{"flagged", URLQuery{Flagged: true}, []int64{flagged.ID}},
+			{"tag and search", URLQuery{Tag: "shop", Search: "bad"}, []int64{flagged.ID}},
+		}
+		for _, tt := range tests {
+			tt.q.UserID = user.ID
+			got, err := listAllURLs(db, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	})
+}
+
+// listAllURLs follows the pages of a query and returns the IDs it found.
+func listAllURLs(db *DB, q URLQuery) ([]int64, error) {
+	var ids []int64
+	for pages := 0; pages < 100; pages++ {
+		page, err := db.ListURLs(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, url := range page.URLs {
+			ids = append(ids, url.ID)
+		}
+		if page.Next == "" {
+			return ids, nil
+		}
+		q.After = page.Next
+	}
+	return nil, errors.New("too many pages")
+}
+
+func TestRecordClicks(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+		a := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/a", Key: "a"})
+		deleted := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/b", Key: "b"})
+		if err := db.DeleteURL(deleted.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		err := db.RecordClicks([]*Click{
+			{URLID: a.ID, Key: "a", ClickedAt: now.Add(-time.Minute), Referrer: "https://ref.example"},
+			{URLID: deleted.ID, Key: "b", ClickedAt: now},
+			{URLID: a.ID, Key: "a", ClickedAt: now},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		url, err := db.GetURLByID(a.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url.Clicks != 2 {
+			t.Errorf("got %d clicks, want 2", url.Clicks)
+		}
+		if url.LastClickedAt == nil || !url.LastClickedAt.Equal(now) {
+			t.Errorf("got last click at %v, want %v", url.LastClickedAt, now)
+		}
+
+		var stored int
+		if err := db.queryRow("SELECT COUNT(*) FROM clicks").Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if stored != 2 {
+			t.Errorf("%d clicks were stored, want 2", stored)
+		}
+
+		buckets, err := db.GetClickBuckets(a.ID, BucketHour, now.Add(-2*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, bucket := range buckets {
+			total += bucket.Count
+		}
+		if len(buckets) != 3 || total != 2 {
+			t.Errorf("got buckets %v, want 3 buckets with 2 clicks", buckets)
+		}
+	})
+}
+
+func TestRecordLimitedClick(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+		url := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/a", Key: "a", MaxClicks: 2})
+
+		for i, want := range []bool{true, true, false} {
+			counted, err := db.RecordLimitedClick(&Click{URLID: url.ID, Key: "a", ClickedAt: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counted != want {
+				t.Errorf("click %d: counted is %v, want %v", i+1, counted, want)
+			}
+		}
+
+		limited, err := db.GetURL("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limited.Clicks != 2 || !limited.IsExpired() {
+			t.Errorf("got %d clicks and expired %v, want 2 and true", limited.Clicks, limited.IsExpired())
+		}
+	})
+}
+
+func TestModeration(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		admin := createTestUser(t, db, "admin")
+		user := createTestUser(t, db, "spam_user")
+		createTestUser(t, db, "spamXuser")
+		reported := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/reported", Key: "reported"})
+		other := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/other", Key: "other"})
+
+		users, err := db.SearchUsers("spam_", 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].ID != user.ID {
+			t.Errorf("SearchUsers(spam_) returned %v, want only %s", users, user.Username)
+		}
+
+		// Two reports from the same reporter count once.
+		for i, reporter := range []string{"r1", "r1", "r2"} {
+			disabled, err := db.CreateAbuseReport(&AbuseReport{URLID: reported.ID, Reason: "spam", ReporterHash: reporter}, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := i == 2; disabled != want {
+				t.Errorf("report %d: disabled is %v, want %v", i+1, disabled, want)
+			}
+		}
+
+		url, err := db.GetURL("reported")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !url.Disabled {
+			t.Error("URL was not disabled by the reports")
+		}
+
+		searchIDs := func(filter string) []int64 {
+			t.Helper()
+			urls, err := db.SearchURLs("", filter, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, url := range urls {
+				ids = append(ids, url.ID)
+			}
+			return ids
+		}
+		if got, want := searchIDs(URLFilterReported), []int64{reported.ID}; !reflect.DeepEqual(got, want) {
+			t.Errorf("reported URLs are %v, want %v", got, want)
+		}
+		if got, want := searchIDs(URLFilterDisabled), []int64{reported.ID}; !reflect.DeepEqual(got, want) {
+			t.Errorf("disabled URLs are %v, want %v", got, want)
+		}
+		if got, want := searchIDs(URLFilterAll), []int64{other.ID, reported.ID}; !reflect.DeepEqual(got, want) {
+			t.Errorf("all URLs are %v, want %v", got, want)
+		}
+
+		if err := db.SetURLDisabled(admin.ID, reported.ID, false, "false alarm"); err != nil {
+			t.Fatal(err)
+		}
+		if got := searchIDs(URLFilterReported); len(got) != 0 {
+			t.Errorf("an admin's decision left reports unresolved on %v", got)
+		}
+		if url, err := db.GetURL("reported"); err != nil || url.Disabled {
+			t.Errorf("URL is still disabled: %v", err)
+		}
+
+		if err := db.SetUserDisabled(admin.ID, user.ID, true, true, "spammer"); err != nil {
+			t.Fatal(err)
+		}
+		if url, err := db.GetURL("other"); err != nil || !url.Disabled {
+			t.Errorf("disabling the user left URL other enabled: %v", err)
+		}
+
+		if err := db.ModerateDeleteURL(admin.ID, other.ID, "spam"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.GetURL("other"); !errors.Is(err, ErrURLNotFound) {
+			t.Errorf("deleted URL is still found: %v", err)
+		}
+
+		actions, err := db.GetModerationActions(10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, action := range actions {
+			got = append(got, fmt.Sprintf("%s %s %s %s", action.AdminUsername, action.Action, action.TargetLabel, action.Reason))
+		}
+		want := []string{
+			"admin delete_url other spam",
+			"admin disable_user spam_user spammer (links disabled)",
+			"admin enable_url reported false alarm",
+			" disable_url reported 2 abuse reports",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got moderation actions\n%q\nwant\n%q", got, want)
+		}
+	})
+}
+
+func TestUpdateSafetyStatus(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *DB) {
+		user := createTestUser(t, db, "alice")
+		url := insertTestURL(t, db, &URL{UserID: user.ID, URL: "https://example.com/a", Key: "a"})
+
+		checkedAt := time.Now()
+		updated, err := db.UpdateSafetyStatus(url.ID, "https://example.com/old", SafetyFlagged, "MALWARE", checkedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated {
+			t.Error("the result of checking an old destination was recorded")
+		}
+
+		updated, err = db.UpdateSafetyStatus(url.ID, url.URL, SafetyFlagged, "MALWARE", checkedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !updated {
+			t.Error("the result of checking the current destination was not recorded")
+		}
+
+		flagged, err := db.GetURL("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !flagged.IsFlagged() || flagged.SafetyThreat != "MALWARE" || flagged.LastCheckedAt == nil {
+			t.Errorf("got %+v", flagged)
+		}
+
+		pending, err := db.GetURLsForSafetyCheck(0, checkedAt.Add(-time.Minute), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 0 {
+			t.Errorf("a URL checked just now is due for a check: %v", pending)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tag is a label on one or more of a user's URLs.
+type Tag struct {
+	Name string
+	URLs int
+}
+
+// loadTags fills in the tags of urls.
+func (db *DB) loadTags(urls []URL) error {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*URL, len(urls))
+	args := make([]interface{}, 0, len(urls))
+	for i := range urls {
+		byID[urls[i].ID] = &urls[i]
+		args = append(args, urls[i].ID)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(urls)), ", ")
+	rows, err := db.query("SELECT url_tags.url_id, tags.name FROM url_tags JOIN tags ON tags.id = url_tags.tag_id WHERE url_tags.url_id IN ("+placeholders+") ORDER BY tags.name", args...)
+	if err != nil {
+		return fmt.Errorf("error querying tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var urlID int64
+		var name string
+		if err := rows.Scan(&urlID, &name); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		url := byID[urlID]
+		url.Tags = append(url.Tags, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+	return nil
+}
+
+// SetURLTags replaces the tags of a URL with a list of distinct tags, which
+// are created for the user as needed.
+func (db *DB) SetURLTags(urlID, userID int64, tags []string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.exec("DELETE FROM url_tags WHERE url_id = ?", urlID); err != nil {
+		return fmt.Errorf("error deleting tags: %w", err)
+	}
+
+	if err := setURLTags(tx, urlID, userID, tags); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// setURLTags adds tags to a URL that has none. The tags must be distinct.
+func setURLTags(tx *txn, urlID, userID int64, tags []string) error {
+	for _, name := range tags {
+		if _, err := tx.exec("INSERT INTO tags (user_id, name) VALUES (?, ?) ON CONFLICT (user_id, name) DO NOTHING", userID, name); err != nil {
+			return fmt.Errorf("error inserting tag: %w", err)
+		}
+
+		var tagID int64
+		if err := tx.queryRow("SELECT id FROM tags WHERE user_id = ? AND name = ?", userID, name).Scan(&tagID); err != nil {
+			return fmt.Errorf("error querying tag: %w", err)
+		}
+
+		if _, err := tx.exec("INSERT INTO url_tags (url_id, tag_id) VALUES (?, ?)", urlID, tagID); err != nil {
+			return fmt.Errorf("error tagging URL: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetTagsByUserID returns the tags that are on at least one of the user's
+// URLs, by name.
+func (db *DB) GetTagsByUserID(userID int64) ([]Tag, error) {
+	rows, err := db.query("SELECT tags.name, COUNT(*) FROM tags JOIN url_tags ON url_tags.tag_id = tags.id WHERE tags.user_id = ? GROUP BY tags.name ORDER BY tags.name", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.Name, &tag.URLs); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/gorilla/sessions"
+)
+
+const adminPageSize = 50
+
+const maxModerationReasonLength = 500
+
+// adminPage is the pagination state shared by the admin lists. PrevURL and
+// NextURL are empty on the first and last page.
+type adminPage struct {
+	Page    int
+	PrevURL string
+	NextURL string
+}
+
+func (h *Handler) adminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/admin", h.adminIndexHandler)
+	mux.HandleFunc("/admin/users", h.adminUsersHandler)
+	mux.HandleFunc("/admin/users/", h.adminUserActionHandler)
+	mux.HandleFunc("/admin/links", h.adminLinksHandler)
+	mux.HandleFunc("/admin/links/", h.adminLinkActionHandler)
+	mux.HandleFunc("/admin/audit", h.adminAuditHandler)
+}
+
+// activeUsers reloads the user stored in the session on every request, so
+// that disabling a user or changing their role takes effect immediately.
+// Sessions of disabled or deleted users are logged out.
+func (h *Handler) activeUsers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := h.store.Get(r, "session")
+		if user, ok := session.Values["user"].(*database.User); ok {
+			current, err := h.db.GetUserByID(user.ID)
+			if err != nil {
+				http.Error(w, "Error loading user", http.StatusInternalServerError)
+				return
+			}
+
+			if current == nil || current.Disabled {
+				delete(session.Values, "user")
+				session.Save(r, w)
+			} else {
+				// The session is cached for the rest of the request, so
+				// handlers see the current user without saving it.
+				session.Values["user"] = current
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminUser returns the logged in user if they are an admin. Other users get
+// a 404 so that the admin area is not advertised.
+func (h *Handler) adminUser(w http.ResponseWriter, r *http.Request) (*database.User, *sessions.Session, bool) {
+	session, _ := h.store.Get(r, "session")
+	user, ok := session.Values["user"].(*database.User)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return nil, nil, false
+	}
+
+	if !user.IsAdmin {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	return user, session, true
+}
+
+func adminFlashes(w http.ResponseWriter, r *http.Request, session *sessions.Session) (string, string) {
+	var errorMsg, successMsg string
+	if flashes := session.Flashes("error"); len(flashes) > 0 {
+		errorMsg, _ = flashes[0].(string)
+	}
+	if flashes := session.Flashes("success"); len(flashes) > 0 {
+		successMsg, _ = flashes[0].(string)
+	}
+	session.Save(r, w)
+	return errorMsg, successMsg
+}
+
+// pageNumber returns the 1-based page requested in the query string.
+func pageNumber(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// pageItems drops the extra row fetched to find out whether there is a next
+// page.
+func pageItems[T any](items []T) []T {
+	if len(items) > adminPageSize {
+		return items[:adminPageSize]
+	}
+	return items
+}
+
+// newAdminPage links to the neighbouring pages, keeping the list's other
+// query parameters.
+func newAdminPage(page, results int, query url.Values) adminPage {
+	pageURL := func(n int) string {
+		query.Set("page", strconv.Itoa(n))
+		return "?" + query.Encode()
+	}
+
+	p := adminPage{Page: page}
+	if page > 1 {
+		p.PrevURL = pageURL(page - 1)
+	}
+	if results > adminPageSize {
+		p.NextURL = pageURL(page + 1)
+	}
+	return p
+}
+
+// adminReturnPath is where an admin action sends the admin back to. It comes
+// from the form so that the list keeps its search and page.
+func adminReturnPath(r *http.Request, fallback string) string {
+	path := r.FormValue("return")
+	if !strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "//") {
+		return fallback
+	}
+	return path
+}
+
+// adminAction parses the ID and action from /admin/{kind}/{id}/{action}.
+func adminAction(r *http.Request, prefix string) (int64, string, bool) {
+	idPart, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if !ok {
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return id, action, true
+}
+
+func moderationReason(r *http.Request) (string, bool) {
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	return reason, len(reason) <= maxModerationReasonLength
+}
+
+func (h *Handler) adminIndexHandler(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := h.adminUser(w, r); !ok {
+		return
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (h *Handler) adminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	admin, session, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	page := pageNumber(r)
+
+	// One extra row tells whether there is a next page.
+	users, err := h.db.SearchUsers(query, adminPageSize+1, (page-1)*adminPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	errorMsg, successMsg := adminFlashes(w, r, session)
+
+	data := struct {
+		Admin      *database.User
+		Section    string
+		Users      []database.User
+		Query      string
+		Pagination adminPage
+		ReturnPath string
+		Success    string
+		Error      string
+	}{
+		Admin:      admin,
+		Section:    "users",
+		Users:      pageItems(users),
+		Query:      query,
+		Pagination: newAdminPage(page, len(users), url.Values{"q": {query}}),
+		ReturnPath: r.URL.RequestURI(),
+		Success:    successMsg,
+		Error:      errorMsg,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "admin_users.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) adminUserActionHandler(w http.ResponseWriter, r *http.Request) {
+	admin, session, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, action, ok := adminAction(r, "/admin/users/")
+	if !ok || (action != "disable" && action != "enable") {
+		http.NotFound(w, r)
+		return
+	}
+
+	returnPath := adminReturnPath(r, "/admin/users")
+
+	reason, ok := moderationReason(r)
+	if !ok {
+		session.AddFlash("Reason is too long", "error")
+		session.Save(r, w)
+		http.Redirect(w, r, returnPath, http.StatusSeeOther)
+		return
+	}
+
+	disable := action == "disable"
+	if disable && userID == admin.ID {
+		session.AddFlash("You cannot disable your own account", "error")
+		session.Save(r, w)
+		http.Redirect(w, r, returnPath, http.StatusSeeOther)
+		return
+	}
+
+	includeURLs := disable && r.FormValue("disable_links") != ""
+	if err := h.db.SetUserDisabled(admin.ID, userID, disable, includeURLs, reason); err != nil {
+		log.Printf("Error moderating user %d: %v", userID, err)
+		session.AddFlash("Error updating the user", "error")
+		session.Save(r, w)
+		http.Redirect(w, r, returnPath, http.StatusSeeOther)
+		return
+	}
+
+	log.Printf("Admin %d: %s user %d", admin.ID, action, userID)
+	if disable {
+		session.AddFlash("User disabled", "success")
+	} else {
+		session.AddFlash("User enabled", "success")
+	}
+	session.Save(r, w)
+	http.Redirect(w, r, returnPath, http.StatusSeeOther)
+}
+
+func (h *Handler) adminLinksHandler(w http.ResponseWriter, r *http.Request) {
+	admin, session, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	filter := r.URL.Query().Get("filter")
+	switch filter {
+	case database.URLFilterAll, database.URLFilterFlagged, database.URLFilterDisabled, database.URLFilterReported:
+	default:
+		http.Error(w, "Invalid filter", http.StatusBadRequest)
+		return
+	}
+	page := pageNumber(r)
+
+	urls, err := h.db.SearchURLs(query, filter, adminPageSize+1, (page-1)*adminPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	errorMsg, successMsg := adminFlashes(w, r, session)
+
+	data := struct {
+		Admin      *database.User
+		Section    string
+		URLs       []database.URLWithOwner
+		Query      string
+		Filter     string
+		Pagination adminPage
+		ReturnPath string
+		Success    string
+		Error      string
+	}{
+		Admin:      admin,
+		Section:    "links",
+		URLs:       pageItems(urls),
+		Query:      query,
+		Filter:     filter,
+		Pagination: newAdminPage(page, len(urls), url.Values{"q": {query}, "filter": {filter}}),
+		ReturnPath: r.URL.RequestURI(),
+		Success:    successMsg,
+		Error:      errorMsg,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "admin_links.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) adminLinkActionHandler(w http.ResponseWriter, r *http.Request) {
+	admin, session, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	urlID, action, ok := adminAction(r, "/admin/links/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if action == "reports" {
+		h.adminReportsHandler(w, r, admin, urlID)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	returnPath := adminReturnPath(r, "/admin/links")
+
+	reason, ok := moderationReason(r)
+	if !ok {
+		session.AddFlash("Reason is too long", "error")
+		session.Save(r, w)
+		http.Redirect(w, r, returnPath, http.StatusSeeOther)
+		return
+	}
+
+	var err error
+	var success string
+	switch action {
+	case "disable":
+		err = h.db.SetURLDisabled(admin.ID, urlID, true, reason)
+		success = "Link disabled"
+	case "enable":
+		err = h.db.SetURLDisabled(admin.ID, urlID, false, reason)
+		success = "Link enabled"
+	case "delete":
+		err = h.db.ModerateDeleteURL(admin.ID, urlID, reason)
+		success = "Link deleted"
+	case "dismiss":
+		err = h.db.DismissAbuseReports(admin.ID, urlID, reason)
+		success = "Reports dismissed"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error moderating URL %d: %v", urlID, err)
+		session.AddFlash("Error updating the link", "error")
+		session.Save(r, w)
+		http.Redirect(w, r, returnPath, http.StatusSeeOther)
+		return
+	}
+
+	log.Printf("Admin %d: %s URL %d", admin.ID, action, urlID)
+	session.AddFlash(success, "success")
+	session.Save(r, w)
+	http.Redirect(w, r, returnPath, http.StatusSeeOther)
+}
+
+// adminReportsHandler lists the abuse reports against a link.
+func (h *Handler) adminReportsHandler(w http.ResponseWriter, r *http.Request, admin *database.User, urlID int64) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	url, err := h.db.GetURLByID(urlID)
+	if err != nil {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	reports, err := h.db.GetAbuseReports(urlID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Admin      *database.User
+		Section    string
+		URL        *database.URL
+		Reports    []database.AbuseReport
+		ReturnPath string
+		Success    string
+		Error      string
+	}{
+		Admin:      admin,
+		Section:    "links",
+		URL:        url,
+		Reports:    reports,
+		ReturnPath: "/admin/links?filter=" + database.URLFilterReported,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "admin_reports.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) adminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	admin, session, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page := pageNumber(r)
+	actions, err := h.db.GetModerationActions(adminPageSize+1, (page-1)*adminPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	errorMsg, successMsg := adminFlashes(w, r, session)
+
+	data := struct {
+		Admin      *database.User
+		Section    string
+		Actions    []database.ModerationAction
+		Pagination adminPage
+		Success    string
+		Error      string
+	}{
+		Admin:      admin,
+		Section:    "audit",
+		Actions:    pageItems(actions),
+		Pagination: newAdminPage(page, len(actions), url.Values{}),
+		Success:    successMsg,
+		Error:      errorMsg,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "admin_audit.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/utils"
+)
+
+// maxHeaderLength caps the request headers stored with each click.
+const maxHeaderLength = 512
+
+// maxClickBuckets limits how far back a single API request can reach.
+const maxClickBuckets = 1000
+
+// clickBar is a click bucket prepared for rendering as a bar chart row.
+type clickBar struct {
+	Start   time.Time
+	Count   int
+	Percent int
+}
+
+type apiClickBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+func (h *Handler) newClick(r *http.Request, url *database.URL, key string) *database.Click {
+	return &database.Click{
+		URLID:          url.ID,
+		Key:            key,
+		ClickedAt:      time.Now(),
+		Referrer:       truncate(r.Referer(), maxHeaderLength),
+		UserAgent:      truncate(r.UserAgent(), maxHeaderLength),
+		IPHash:         h.hashRemoteIP(r),
+		AcceptLanguage: truncate(r.Header.Get("Accept-Language"), maxHeaderLength),
+	}
+}
+
+// hashRemoteIP identifies the client without keeping its IP address.
+func (h *Handler) hashRemoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return utils.HashIP(ip, h.ipHashSalt)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func newClickBars(buckets []database.ClickBucket) []clickBar {
+	max := 0
+	for _, bucket := range buckets {
+		if bucket.Count > max {
+			max = bucket.Count
+		}
+	}
+
+	bars := make([]clickBar, 0, len(buckets))
+	for _, bucket := range buckets {
+		bar := clickBar{Start: bucket.Start, Count: bucket.Count}
+		if max > 0 {
+			bar.Percent = bucket.Count * 100 / max
+		}
+		bars = append(bars, bar)
+	}
+	return bars
+}
+
+// apiClicksHandler serves /api/v1/urls/{id}/clicks. The bucket size is
+// chosen with ?interval=hour|day and the range with ?since=<RFC 3339 time>,
+// which defaults to the last 24 hours or 30 days.
+func (h *Handler) apiClicksHandler(w http.ResponseWriter, r *http.Request, url *database.URL) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	var since time.Time
+	var step time.Duration
+	switch interval {
+	case "", database.BucketHour:
+		interval = database.BucketHour
+		since = time.Now().Add(-23 * time.Hour)
+		step = time.Hour
+	case database.BucketDay:
+		since = time.Now().AddDate(0, 0, -29)
+		step = 24 * time.Hour
+	default:
+		writeJSONError(w, http.StatusBadRequest, "invalid_interval", "Interval must be either hour or day")
+		return
+	}
+
+	if value := r.URL.Query().Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_since", "Since must be an RFC 3339 timestamp")
+			return
+		}
+		since = t
+	}
+
+	if time.Since(since) > maxClickBuckets*step {
+		writeJSONError(w, http.StatusBadRequest, "invalid_since", "Since is too far in the past for this interval")
+		return
+	}
+
+	buckets, err := h.db.GetClickBuckets(url.ID, interval, since)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error loading clicks")
+		return
+	}
+
+	result := make([]apiClickBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		result = append(result, apiClickBucket{Start: bucket.Start, Count: bucket.Count})
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Interval string           `json:"interval"`
+		Buckets  []apiClickBucket `json:"buckets"`
+	}{
+		Interval: interval,
+		Buckets:  result,
+	})
+}
@@ -0,0 +1,592 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/utils"
+)
+
+const maxAPIBodySize = 1 << 20
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiURL struct {
+	ID          int64      `json:"id"`
+	URL         string     `json:"url"`
+	Key         string     `json:"key"`
+	Title       string     `json:"title"`
+	ShortURL    string     `json:"short_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Clicks      int        `json:"clicks"`
+	HasPassword bool       `json:"has_password"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	MaxClicks   int        `json:"max_clicks"`
+	Expired     bool       `json:"expired"`
+	// LastClickedAt is null for links that were never clicked.
+	LastClickedAt *time.Time `json:"last_clicked_at"`
+	// SafetyStatus is unchecked, safe or flagged. Flagged links do not
+	// redirect until their destination is changed.
+	SafetyStatus  string     `json:"safety_status"`
+	SafetyThreat  string     `json:"safety_threat,omitempty"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	// Disabled links were disabled by an admin and do not redirect.
+	Disabled bool     `json:"disabled"`
+	FolderID *int64   `json:"folder_id"`
+	Tags     []string `json:"tags"`
+}
+
+type apiCreateURLRequest struct {
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias"`
+	Title     string     `json:"title"`
+	Password  string     `json:"password"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxClicks int        `json:"max_clicks"`
+	FolderID  int64      `json:"folder_id"`
+	Tags      []string   `json:"tags"`
+}
+
+// apiUpdateURLRequest uses pointers so that omitted fields keep their current
+// value. An empty password removes password protection and a null expires_at
+// removes the expiry date. A folder_id of 0 or null takes the URL out of its
+// folder, and tags replaces all of the URL's tags.
+type apiUpdateURLRequest struct {
+	URL       *string      `json:"url"`
+	Alias     *string      `json:"alias"`
+	Title     *string      `json:"title"`
+	Password  *string      `json:"password"`
+	ExpiresAt optionalTime `json:"expires_at"`
+	MaxClicks *int         `json:"max_clicks"`
+	FolderID  optionalID   `json:"folder_id"`
+	Tags      *[]string    `json:"tags"`
+}
+
+// optionalTime tells an explicit null apart from a field that was omitted.
+type optionalTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (t *optionalTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	return json.Unmarshal(data, &t.Value)
+}
+
+// optionalID is like optionalTime for IDs, with null meaning zero.
+type optionalID struct {
+	Set   bool
+	Value int64
+}
+
+func (id *optionalID) UnmarshalJSON(data []byte) error {
+	id.Set = true
+	var value *int64
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if value != nil {
+		id.Value = *value
+	}
+	return nil
+}
+
+func (h *Handler) apiRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/v1/", h.apiNotFoundHandler)
+	mux.HandleFunc("/api/v1/urls", h.apiURLsHandler)
+	mux.HandleFunc("/api/v1/urls/", h.apiURLHandler)
+	mux.HandleFunc("/api/v1/tokens", h.apiTokensHandler)
+	mux.HandleFunc("/api/v1/tokens/", h.apiTokenHandler)
+	mux.HandleFunc("/api/v1/folders", h.apiFoldersHandler)
+	mux.HandleFunc("/api/v1/folders/", h.apiFolderHandler)
+	mux.HandleFunc("/api/v1/tags", h.apiTagsHandler)
+	mux.HandleFunc("/api/v1/export/", h.apiExportHandler)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, struct {
+		Error apiError `json:"error"`
+	}{
+		Error: apiError{Code: code, Message: message},
+	})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+}
+
+// decodeJSON reads the request body into v. Bodies must be sent as
+// application/json, which a cross-site form cannot do without a CORS
+// preflight, so that the session cookie cannot be used to change data from
+// another site.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json")
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodySize)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeValidationError maps the errors returned by validateURL to API
+// responses.
+func writeValidationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errURLRequired):
+		writeJSONError(w, http.StatusBadRequest, "url_required", err.Error())
+	case errors.Is(err, errInvalidURL):
+		writeJSONError(w, http.StatusBadRequest, "invalid_url", err.Error())
+	case errors.Is(err, errUnsafeURL):
+		writeJSONError(w, http.StatusUnprocessableEntity, "unsafe_url", err.Error())
+	default:
+		writeJSONError(w, http.StatusBadGateway, "safety_check_failed", err.Error())
+	}
+}
+
+// writeAliasError maps the errors returned by checkAlias to API responses.
+func writeAliasError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errAliasTaken), errors.Is(err, database.ErrKeyTaken):
+		writeJSONError(w, http.StatusConflict, "alias_taken", errAliasTaken.Error())
+	case errors.Is(err, errAliasCheck):
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+	default:
+		writeJSONError(w, http.StatusBadRequest, "invalid_alias", err.Error())
+	}
+}
+
+func writeExpiryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidMaxClicks) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_max_clicks", err.Error())
+		return
+	}
+	writeJSONError(w, http.StatusBadRequest, "invalid_expiry", err.Error())
+}
+
+// writeQueryError maps the errors returned by parseURLQuery to API responses.
+func writeQueryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidSort):
+		writeJSONError(w, http.StatusBadRequest, "invalid_sort", err.Error())
+	case errors.Is(err, errInvalidOrder):
+		writeJSONError(w, http.StatusBadRequest, "invalid_order", err.Error())
+	case errors.Is(err, errInvalidLimit):
+		writeJSONError(w, http.StatusBadRequest, "invalid_limit", err.Error())
+	default:
+		writeJSONError(w, http.StatusBadRequest, "invalid_cursor", errInvalidCursor.Error())
+	}
+}
+
+// writeOrganizeError maps the errors returned by checkFolder and
+// utils.NormalizeTags to API responses.
+func writeOrganizeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errFolderNotFound):
+		writeJSONError(w, http.StatusBadRequest, "invalid_folder", err.Error())
+	case errors.Is(err, utils.ErrTooManyTags), errors.Is(err, utils.ErrTagTooLong):
+		writeJSONError(w, http.StatusBadRequest, "invalid_tags", err.Error())
+	default:
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error loading folder")
+	}
+}
+
+func newAPIURL(base string, url *database.URL) apiURL {
+	var folderID *int64
+	if url.FolderID != 0 {
+		folderID = &url.FolderID
+	}
+	tags := url.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return apiURL{
+		ID:          url.ID,
+		URL:         url.URL,
+		Key:         url.Key,
+		Title:       url.Title,
+		ShortURL:    shortURL(base, url.Key),
+		CreatedAt:   url.CreatedAt,
+		Clicks:      url.Clicks,
+		HasPassword: url.Password != "",
+		ExpiresAt:   url.ExpiresAt,
+		MaxClicks:   url.MaxClicks,
+		Expired:     url.IsExpired(),
+
+		LastClickedAt: url.LastClickedAt,
+		SafetyStatus:  url.SafetyStatus,
+		SafetyThreat:  url.SafetyThreat,
+		LastCheckedAt: url.LastCheckedAt,
+		Disabled:      url.Disabled,
+		FolderID:      folderID,
+		Tags:          tags,
+	}
+}
+
+// apiUser authenticates an API request, either with a bearer token or with
+// the session cookie used by the web interface. Tokens must carry a scope
+// that covers the request method; sessions have full access.
+func (h *Handler) apiUser(w http.ResponseWriter, r *http.Request) (*database.User, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		session, _ := h.store.Get(r, "session")
+		user, ok := session.Values["user"].(*database.User)
+		if !ok {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+			return nil, false
+		}
+		return user, true
+	}
+
+	const prefix = "Bearer "
+	if len(authHeader) <= len(prefix) || !strings.EqualFold(authHeader[:len(prefix)], prefix) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Authorization header must use the Bearer scheme")
+		return nil, false
+	}
+
+	token, err := h.db.GetAPITokenByHash(utils.HashAPIToken(strings.TrimSpace(authHeader[len(prefix):])))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error checking API token")
+		return nil, false
+	}
+	if token == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Invalid API token")
+		return nil, false
+	}
+
+	if !scopeAllows(token.Scope, r.Method) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		writeJSONError(w, http.StatusForbidden, "insufficient_scope", "API token does not allow this operation")
+		return nil, false
+	}
+
+	user, err := h.db.GetUserByID(token.UserID)
+	if err != nil || user == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Invalid API token")
+		return nil, false
+	}
+
+	if user.Disabled {
+		writeJSONError(w, http.StatusForbidden, "account_disabled", "This account has been disabled")
+		return nil, false
+	}
+
+	if err := h.db.TouchAPIToken(token.ID); err != nil {
+		log.Printf("Error updating API token last use: %v", err)
+	}
+
+	return user, true
+}
+
+// apiOwnedURL loads the URL whose ID follows /api/v1/urls/ in the request
+// path and checks that it belongs to user. It also returns the rest of the
+// path, which names a sub-resource of the URL.
+func (h *Handler) apiOwnedURL(w http.ResponseWriter, r *http.Request, user *database.User) (*database.URL, string, bool) {
+	idPart, subresource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/urls/"), "/")
+	urlID, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "URL not found")
+		return nil, "", false
+	}
+
+	url, err := h.db.GetURLByID(urlID)
+	if err != nil || url.UserID != user.ID {
+		writeJSONError(w, http.StatusNotFound, "not_found", "URL not found")
+		return nil, "", false
+	}
+
+	return url, subresource, true
+}
+
+func (h *Handler) apiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+}
+
+func (h *Handler) apiURLsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.apiUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		query, err := parseURLQuery(params, user.ID)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+
+		query.Limit = defaultAPIPageSize
+		if limit := params.Get("limit"); limit != "" {
+			query.Limit, err = strconv.Atoi(limit)
+			if err != nil || query.Limit < 1 || query.Limit > maxAPIPageSize {
+				writeQueryError(w, errInvalidLimit)
+				return
+			}
+		}
+
+		if folder := params.Get("folder_id"); folder != "" {
+			query.FolderID, err = strconv.ParseInt(folder, 10, 64)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid_folder", errFolderNotFound.Error())
+				return
+			}
+		}
+
+		page, err := h.db.ListURLs(query)
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidCursor) {
+				writeQueryError(w, errInvalidCursor)
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error loading URLs")
+			return
+		}
+
+		result := make([]apiURL, 0, len(page.URLs))
+		for i := range page.URLs {
+			result = append(result, newAPIURL(baseURL(r), &page.URLs[i]))
+		}
+
+		var next *string
+		if page.Next != "" {
+			next = &page.Next
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			URLs       []apiURL `json:"urls"`
+			NextCursor *string  `json:"next_cursor"`
+		}{
+			URLs:       result,
+			NextCursor: next,
+		})
+	case http.MethodPost:
+		var req apiCreateURLRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		url, err := h.validateURL(req.URL)
+		if err != nil {
+			writeValidationError(w, err)
+			return
+		}
+
+		if err := validateExpiry(req.ExpiresAt, req.MaxClicks); err != nil {
+			writeExpiryError(w, err)
+			return
+		}
+
+		title, err := validateTitle(req.Title)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_title", err.Error())
+			return
+		}
+
+		hashedPassword, err := hashPassword(req.Password)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error hashing password")
+			return
+		}
+
+		if req.Alias != "" {
+			if err := h.checkAlias(req.Alias, 0); err != nil {
+				writeAliasError(w, err)
+				return
+			}
+		}
+
+		if err := h.checkFolder(user.ID, req.FolderID); err != nil {
+			writeOrganizeError(w, err)
+			return
+		}
+
+		tags, err := utils.NormalizeTags(req.Tags)
+		if err != nil {
+			writeOrganizeError(w, err)
+			return
+		}
+
+		created, err := h.db.InsertURL(markSafe(&database.URL{
+			UserID:    user.ID,
+			URL:       url,
+			Key:       req.Alias,
+			Title:     title,
+			Password:  hashedPassword,
+			ExpiresAt: req.ExpiresAt,
+			MaxClicks: req.MaxClicks,
+			FolderID:  req.FolderID,
+			Tags:      tags,
+		}))
+		if err != nil {
+			if req.Alias != "" && errors.Is(err, database.ErrKeyTaken) {
+				writeAliasError(w, err)
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error inserting URL into database")
+			return
+		}
+
+		h.saveQRCode(r, created)
+
+		w.Header().Set("Location", "/api/v1/urls/"+strconv.FormatInt(created.ID, 10))
+		writeJSON(w, http.StatusCreated, newAPIURL(baseURL(r), created))
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h *Handler) apiURLHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.apiUser(w, r)
+	if !ok {
+		return
+	}
+
+	url, subresource, ok := h.apiOwnedURL(w, r, user)
+	if !ok {
+		return
+	}
+
+	switch subresource {
+	case "":
+	case "clicks":
+		h.apiClicksHandler(w, r, url)
+		return
+	default:
+		writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, newAPIURL(baseURL(r), url))
+	case http.MethodPut, http.MethodPatch:
+		var req apiUpdateURLRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		if req.URL != nil {
+			newURL, err := h.validateURL(*req.URL)
+			if err != nil {
+				writeValidationError(w, err)
+				return
+			}
+			url.URL = newURL
+			markSafe(url)
+		}
+
+		renamed := req.Alias != nil && *req.Alias != url.Key
+		if renamed {
+			if err := h.checkAlias(*req.Alias, url.ID); err != nil {
+				writeAliasError(w, err)
+				return
+			}
+		}
+
+		if req.Title != nil {
+			title, err := validateTitle(*req.Title)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid_title", err.Error())
+				return
+			}
+			url.Title = title
+		}
+
+		if req.Password != nil {
+			hashedPassword, err := hashPassword(*req.Password)
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error hashing password")
+				return
+			}
+			url.Password = hashedPassword
+		}
+
+		if req.ExpiresAt.Set {
+			url.ExpiresAt = req.ExpiresAt.Value
+		}
+		if req.MaxClicks != nil {
+			url.MaxClicks = *req.MaxClicks
+		}
+		if req.ExpiresAt.Set || req.MaxClicks != nil {
+			if err := validateExpiry(req.ExpiresAt.Value, url.MaxClicks); err != nil {
+				writeExpiryError(w, err)
+				return
+			}
+		}
+
+		if req.FolderID.Set {
+			if err := h.checkFolder(user.ID, req.FolderID.Value); err != nil {
+				writeOrganizeError(w, err)
+				return
+			}
+			url.FolderID = req.FolderID.Value
+		}
+
+		if req.Tags != nil {
+			tags, err := utils.NormalizeTags(*req.Tags)
+			if err != nil {
+				writeOrganizeError(w, err)
+				return
+			}
+			url.Tags = tags
+		}
+
+		newKey := ""
+		if renamed {
+			newKey = *req.Alias
+		}
+
+		if err := h.db.UpdateURL(url, newKey); err != nil {
+			if errors.Is(err, database.ErrKeyTaken) {
+				writeAliasError(w, err)
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error updating the URL")
+			return
+		}
+
+		if renamed {
+			h.saveQRCode(r, url)
+		}
+
+		writeJSON(w, http.StatusOK, newAPIURL(baseURL(r), url))
+	case http.MethodDelete:
+		if err := h.db.DeleteURL(url.ID); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error deleting the URL")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
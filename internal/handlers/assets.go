@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/artem-streltsov/url-shortener/internal/static"
+	"github.com/artem-streltsov/url-shortener/internal/templates"
+)
+
+// The built-in templates and static files are read from these directories in
+// dev mode, relative to the root of the repository.
+const (
+	sourceTemplatesDir = "internal/templates"
+	sourceStaticDir    = "internal/static"
+)
+
+// Assets says where the templates and static files of the web interface are
+// loaded from. By default they are the ones built into the binary.
+type Assets struct {
+	// ThemeDir is an optional directory whose templates and static
+	// subdirectories hold files that replace the built-in ones with the
+	// same name.
+	ThemeDir string
+	// Dev reads the built-in files from the source tree in the working
+	// directory instead, and reloads templates when they change.
+	Dev bool
+}
+
+// layers returns the file systems with the templates and the static files,
+// each starting with the built-in files and ending with the theme.
+func (a Assets) layers() (templateLayers, staticLayers []fs.FS) {
+	if a.Dev {
+		templateLayers = append(templateLayers, os.DirFS(sourceTemplatesDir))
+		staticLayers = append(staticLayers, os.DirFS(sourceStaticDir))
+	} else {
+		templateLayers = append(templateLayers, templates.FS)
+		staticLayers = append(staticLayers, static.FS)
+	}
+
+	if a.ThemeDir != "" {
+		templateLayers = append(templateLayers, os.DirFS(filepath.Join(a.ThemeDir, "templates")))
+		staticLayers = append(staticLayers, os.DirFS(filepath.Join(a.ThemeDir, "static")))
+	}
+	return templateLayers, staticLayers
+}
+
+// staticFiles serves each file from the last layer that has it, so that a
+// theme can replace single files.
+type staticFiles []fs.FS
+
+func (s staticFiles) find(name string) fs.FS {
+	for i := len(s) - 1; i >= 0; i-- {
+		if info, err := fs.Stat(s[i], name); err == nil && !info.IsDir() {
+			return s[i]
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the file at the request path, which must have had the
+// /static/ prefix stripped. Directories are not listed.
+func (s staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	fsys := s.find(name)
+	if fsys == nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.FileServer(http.FS(fsys)).ServeHTTP(w, r)
+}
+
+// assetURL returns the URL of a static file, which must exist.
+func (s staticFiles) assetURL(name string) (string, error) {
+	if s.find(name) == nil {
+		return "", fmt.Errorf("static file %s does not exist", name)
+	}
+	return "/static/" + name, nil
+}
+
+// check returns an error if one of the third-party files is missing, so that
+// the server does not start with pages that lack their styles and scripts.
+func (s staticFiles) check() error {
+	var missing []string
+	for name := range static.Sources {
+		if s.find(name) == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("static files %s are missing; run go generate ./internal/static", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// templateSet holds the templates parsed from a list of layers, where a
+// template in a later layer replaces the one with the same name in earlier
+// layers. With reload set, the templates are parsed again when a file changed.
+type templateSet struct {
+	layers []fs.FS
+	funcs  template.FuncMap
+	reload bool
+
+	mu        sync.Mutex
+	templates *template.Template
+	version   string
+}
+
+func newTemplateSet(layers []fs.FS, funcs template.FuncMap, reload bool) (*templateSet, error) {
+	s := &templateSet{layers: layers, funcs: funcs, reload: reload}
+	templates, err := s.parse()
+	if err != nil {
+		return nil, err
+	}
+	s.templates, s.version = templates, s.currentVersion()
+	return s, nil
+}
+
+func (s *templateSet) parse() (*template.Template, error) {
+	t := template.New("").Funcs(s.funcs)
+	for i, layer := range s.layers {
+		matches, err := fs.Glob(layer, "*.html")
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			if i == 0 {
+				return nil, fmt.Errorf("no templates found; dev mode has to be started from the root of the repository")
+			}
+			continue
+		}
+		if _, err := t.ParseFS(layer, matches...); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// currentVersion describes the template files, so that a change to any of
+// them changes it.
+func (s *templateSet) currentVersion() string {
+	var b strings.Builder
+	for _, layer := range s.layers {
+		matches, _ := fs.Glob(layer, "*.html")
+		for _, name := range matches {
+			if info, err := fs.Stat(layer, name); err == nil {
+				fmt.Fprintf(&b, "%s %d %d\n", name, info.ModTime().UnixNano(), info.Size())
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (s *templateSet) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	t := s.templates
+	if s.reload {
+		var err error
+		if t, err = s.reloadIfChanged(); err != nil {
+			return err
+		}
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+func (s *templateSet) reloadIfChanged() (*template.Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version := s.currentVersion()
+	if version == s.version {
+		return s.templates, nil
+	}
+	templates, err := s.parse()
+	if err != nil {
+		return nil, fmt.Errorf("error reloading templates: %w", err)
+	}
+	log.Println("Reloaded templates")
+	s.templates, s.version = templates, version
+	return templates, nil
+}
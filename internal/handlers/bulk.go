@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/utils"
+)
+
+const (
+	maxBulkUploadSize = 1 << 20
+	maxBulkRows       = 1000
+)
+
+// bulkColumns are the columns a bulk upload may have. Only url is required.
+var bulkColumns = []string{"url", "alias", "title", "password", "tags", "expires_at", "max_clicks"}
+
+var (
+	errBulkFile     = errors.New("Please choose a CSV file to upload")
+	errBulkTooLarge = fmt.Errorf("The file can be at most %d KB", maxBulkUploadSize>>10)
+	errBulkNoURL    = errors.New("The first row must be a header with a url column")
+	errBulkTooMany  = fmt.Errorf("A file can have at most %d links", maxBulkRows)
+	errBulkEmpty    = errors.New("The file has no links")
+	errBulkDupAlias = errors.New("Alias is used by an earlier row")
+)
+
+// bulkResult is the outcome of one row of a bulk upload.
+type bulkResult struct {
+	Line     int
+	URL      string
+	ShortURL string
+	Error    string
+}
+
+func (h *Handler) bulkHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "session")
+	user, ok := session.Values["user"].(*database.User)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		flashes := session.Flashes("error")
+		var errorMsg string
+		if len(flashes) > 0 {
+			errorMsg, _ = flashes[0].(string)
+		}
+		session.Save(r, w)
+
+		folders, err := h.db.GetFoldersByUserID(user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Folders []database.Folder
+			Columns []string
+			Error   string
+		}{
+			Folders: folders,
+			Columns: bulkColumns,
+			Error:   errorMsg,
+		}
+
+		err = h.templates.ExecuteTemplate(w, "bulk.html", data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxBulkUploadSize)
+		if err := r.ParseMultipartForm(maxBulkUploadSize); err != nil {
+			session.AddFlash(errBulkTooLarge.Error(), "error")
+			session.Save(r, w)
+			http.Redirect(w, r, "/bulk", http.StatusSeeOther)
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			session.AddFlash(errBulkFile.Error(), "error")
+			session.Save(r, w)
+			http.Redirect(w, r, "/bulk", http.StatusSeeOther)
+			return
+		}
+		defer file.Close()
+
+		folderID, err := h.parseFolderForm(r, user.ID)
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
+			session.Save(r, w)
+			http.Redirect(w, r, "/bulk", http.StatusSeeOther)
+			return
+		}
+
+		results, urls, err := h.readBulkCSV(file, user.ID, folderID)
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
+			session.Save(r, w)
+			http.Redirect(w, r, "/bulk", http.StatusSeeOther)
+			return
+		}
+
+		created := 0
+		if len(urls) > 0 {
+			inserted, err := h.db.InsertURLs(urls)
+			if err != nil {
+				if errors.Is(err, database.ErrKeyTaken) {
+					session.AddFlash("No links were created because an alias was taken while uploading, please try again", "error")
+				} else {
+					session.AddFlash("Error inserting URLs into database, no links were created", "error")
+				}
+				session.Save(r, w)
+				http.Redirect(w, r, "/bulk", http.StatusSeeOther)
+				return
+			}
+
+			// inserted is in the order of urls, which is the order of the
+			// rows without errors.
+			i := 0
+			for j := range results {
+				if results[j].Error != "" {
+					continue
+				}
+				h.saveQRCode(r, inserted[i])
+				results[j].ShortURL = makeShortURL(r, inserted[i].Key)
+				i++
+			}
+			created = len(inserted)
+		}
+
+		download, err := bulkResultsCSV(results)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Results  []bulkResult
+			Created  int
+			Failed   int
+			Download template.URL
+		}{
+			Results:  results,
+			Created:  created,
+			Failed:   len(results) - created,
+			Download: download,
+		}
+
+		err = h.templates.ExecuteTemplate(w, "bulk_results.html", data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// readBulkCSV validates every row of an uploaded file. It returns a result
+// for each row, with an error message for the invalid ones, and the URLs to
+// create for the valid ones in the same order. An error means the file as a
+// whole could not be used.
+func (h *Handler) readBulkCSV(file io.Reader, userID, folderID int64) ([]bulkResult, []*database.URL, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, errBulkNoURL
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheet programs start UTF-8 files with a byte order mark.
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !isBulkColumn(name) {
+			return nil, nil, fmt.Errorf("Unknown column %q, the columns are %s", name, strings.Join(bulkColumns, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, nil, errBulkNoURL
+	}
+
+	var results []bulkResult
+	var urls []*database.URL
+	aliases := make(map[string]bool)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("The file is not valid CSV: %v", err)
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		if len(results) == maxBulkRows {
+			return nil, nil, errBulkTooMany
+		}
+
+		line, _ := reader.FieldPos(0)
+		result := bulkResult{Line: line, URL: field("url")}
+		url, err := h.bulkURL(field, userID, folderID)
+		if err == nil && url.Key != "" {
+			if aliases[url.Key] {
+				err = errBulkDupAlias
+			}
+			aliases[url.Key] = true
+		}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			urls = append(urls, url)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		return nil, nil, errBulkEmpty
+	}
+	return results, urls, nil
+}
+
+// bulkURL validates a row the same way as the new link form.
+func (h *Handler) bulkURL(field func(string) string, userID, folderID int64) (*database.URL, error) {
+	url, err := h.validateURL(field("url"))
+	if err != nil {
+		return nil, err
+	}
+
+	alias := field("alias")
+	if alias != "" {
+		if err := h.checkAlias(alias, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	title, err := validateTitle(field("title"))
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := utils.NormalizeTags(strings.FieldsFunc(field("tags"), func(r rune) bool { return r == ',' || r == ';' }))
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt *time.Time
+	if value := field("expires_at"); value != "" {
+		t, err := parseBulkTime(value)
+		if err != nil {
+			return nil, errInvalidExpiry
+		}
+		expiresAt = &t
+	}
+
+	var maxClicks int
+	if value := field("max_clicks"); value != "" {
+		maxClicks, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, errInvalidMaxClicks
+		}
+	}
+
+	if err := validateExpiry(expiresAt, maxClicks); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := hashPassword(field("password"))
+	if err != nil {
+		return nil, errors.New("Error hashing password")
+	}
+
+	return markSafe(&database.URL{
+		UserID:    userID,
+		URL:       url,
+		Key:       alias,
+		Title:     title,
+		Password:  hashedPassword,
+		ExpiresAt: expiresAt,
+		MaxClicks: maxClicks,
+		FolderID:  folderID,
+		Tags:      tags,
+	}), nil
+}
+
+// parseBulkTime accepts RFC 3339 times, and dates with an optional time of
+// day in UTC.
+func parseBulkTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, expiryInputLayout, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errInvalidExpiry
+}
+
+func isBulkColumn(name string) bool {
+	for _, column := range bulkColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// bulkResultsCSV encodes the results of an upload as a data URL, so that
+// they can be downloaded without storing them on the server.
+func bulkResultsCSV(results []bulkResult) (template.URL, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"line", "url", "short_url", "error"})
+	for _, result := range results {
+		writer.Write([]string{strconv.Itoa(result.Line), result.URL, result.ShortURL, result.Error})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", err
+	}
+
+	// The data URL is built here from our own output, so it is safe to use
+	// as a link.
+	return template.URL("data:text/csv;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+)
+
+var (
+	exportURLColumns = []string{"id", "user_id", "key", "short_url", "url", "title", "created_at", "clicks", "last_clicked_at", "has_password",
+		"expires_at", "max_clicks", "expired", "safety_status", "disabled", "folder_id", "tags"}
+	exportClickColumns = []string{"id", "url_id", "key", "clicked_at", "referrer", "user_agent", "ip_hash", "accept_language"}
+)
+
+// apiExportURL is a link in an export, which also names its owner because
+// admins can export the links of every user.
+type apiExportURL struct {
+	apiURL
+	UserID int64 `json:"user_id"`
+}
+
+type apiClick struct {
+	ID             int64     `json:"id"`
+	URLID          int64     `json:"url_id"`
+	Key            string    `json:"key"`
+	ClickedAt      time.Time `json:"clicked_at"`
+	Referrer       string    `json:"referrer"`
+	UserAgent      string    `json:"user_agent"`
+	IPHash         string    `json:"ip_hash"`
+	AcceptLanguage string    `json:"accept_language"`
+}
+
+// exportEncoder writes the records of an export as they are read from the
+// database. Each record is given both as a value for JSON and as a CSV row.
+type exportEncoder interface {
+	begin(columns []string) error
+	write(value interface{}, row []string) error
+	end() error
+}
+
+type csvExport struct {
+	writer *csv.Writer
+}
+
+func (e *csvExport) begin(columns []string) error {
+	return e.writer.Write(columns)
+}
+
+func (e *csvExport) write(value interface{}, row []string) error {
+	return e.writer.Write(row)
+}
+
+func (e *csvExport) end() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// jsonExport writes a JSON array one element at a time.
+type jsonExport struct {
+	w       io.Writer
+	written bool
+}
+
+func (e *jsonExport) begin(columns []string) error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonExport) write(value interface{}, row []string) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+	if !e.written {
+		separator = "\n"
+		e.written = true
+	}
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExport) end() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+// Datasets and formats of an export.
+const (
+	ExportLinks  = "links"
+	ExportClicks = "clicks"
+	ExportCSV    = "csv"
+	ExportJSON   = "json"
+)
+
+var (
+	ErrExportDataset = errors.New("dataset must be links or clicks")
+	ErrExportFormat  = errors.New("format must be csv or json")
+)
+
+var exportContentTypes = map[string]string{
+	ExportCSV:  "text/csv; charset=utf-8",
+	ExportJSON: "application/json",
+}
+
+// apiExportHandler serves /api/v1/export/links and /api/v1/export/clicks as
+// CSV or JSON. Admins can add all=true to export every user's data. Records
+// are streamed, so a failure part way through can only be reported by
+// cutting the response short.
+func (h *Handler) apiExportHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.apiUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	dataset := strings.TrimPrefix(r.URL.Path, "/api/v1/export/")
+	if dataset != ExportLinks && dataset != ExportClicks {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ExportJSON
+	}
+
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid_format", "Format must be csv or json")
+		return
+	}
+
+	userID := user.ID
+	filename := dataset
+	if r.URL.Query().Get("all") == "true" {
+		if !user.IsAdmin {
+			writeJSONError(w, http.StatusForbidden, "forbidden", "Only admins can export the data of all users")
+			return
+		}
+		userID = 0
+		filename = "all-" + dataset
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, filename, time.Now().UTC().Format("20060102"), format))
+
+	if err := Export(w, h.db, dataset, format, baseURL(r), userID); err != nil {
+		log.Printf("Error exporting %s for user %d: %v", dataset, userID, err)
+	}
+}
+
+// Export writes the links or clicks of a user, or of all users if userID is
+// zero, to w as CSV or JSON. Short URLs in the export start with base, such
+// as https://example.com.
+func Export(w io.Writer, db database.Store, dataset, format, base string, userID int64) error {
+	var encoder exportEncoder
+	switch format {
+	case ExportCSV:
+		encoder = &csvExport{writer: csv.NewWriter(w)}
+	case ExportJSON:
+		encoder = &jsonExport{w: w}
+	default:
+		return ErrExportFormat
+	}
+
+	var columns []string
+	var export func() error
+	switch dataset {
+	case ExportLinks:
+		columns = exportURLColumns
+		export = func() error {
+			return db.ExportURLs(userID, func(url *database.URL) error {
+				return encoder.write(apiExportURL{apiURL: newAPIURL(base, url), UserID: url.UserID}, exportURLRow(base, url))
+			})
+		}
+	case ExportClicks:
+		columns = exportClickColumns
+		export = func() error {
+			return db.ExportClicks(userID, func(click *database.Click) error {
+				return encoder.write(newAPIClick(click), exportClickRow(click))
+			})
+		}
+	default:
+		return ErrExportDataset
+	}
+
+	if err := encoder.begin(columns); err != nil {
+		return err
+	}
+	if err := export(); err != nil {
+		return err
+	}
+	return encoder.end()
+}
+
+func newAPIClick(click *database.Click) apiClick {
+	return apiClick{
+		ID:             click.ID,
+		URLID:          click.URLID,
+		Key:            click.Key,
+		ClickedAt:      click.ClickedAt,
+		Referrer:       click.Referrer,
+		UserAgent:      click.UserAgent,
+		IPHash:         click.IPHash,
+		AcceptLanguage: click.AcceptLanguage,
+	}
+}
+
+func exportURLRow(base string, url *database.URL) []string {
+	folderID := ""
+	if url.FolderID != 0 {
+		folderID = strconv.FormatInt(url.FolderID, 10)
+	}
+
+	return []string{
+		strconv.FormatInt(url.ID, 10),
+		strconv.FormatInt(url.UserID, 10),
+		url.Key,
+		shortURL(base, url.Key),
+		url.URL,
+		url.Title,
+		exportTime(&url.CreatedAt),
+		strconv.Itoa(url.Clicks),
+		exportTime(url.LastClickedAt),
+		strconv.FormatBool(url.Password != ""),
+		exportTime(url.ExpiresAt),
+		strconv.Itoa(url.MaxClicks),
+		strconv.FormatBool(url.IsExpired()),
+		url.SafetyStatus,
+		strconv.FormatBool(url.Disabled),
+		folderID,
+		strings.Join(url.Tags, ";"),
+	}
+}
+
+func exportClickRow(click *database.Click) []string {
+	return []string{
+		strconv.FormatInt(click.ID, 10),
+		strconv.FormatInt(click.URLID, 10),
+		click.Key,
+		exportTime(&click.ClickedAt),
+		click.Referrer,
+		click.UserAgent,
+		click.IPHash,
+		click.AcceptLanguage,
+	}
+}
+
+// exportTime formats times in CSV exports as RFC 3339 in UTC, and missing
+// times as empty cells.
+func exportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/utils"
+)
+
+const maxFolderNameLength = 64
+
+var (
+	errFolderNotFound   = errors.New("Folder not found")
+	errFolderName       = errors.New("Folder name is required")
+	errFolderNameLength = fmt.Errorf("Folder names can be at most %d characters long", maxFolderNameLength)
+	errFolderExists     = errors.New("You already have a folder with this name")
+)
+
+type apiFolder struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	URLs      int       `json:"urls"`
+}
+
+type apiTag struct {
+	Name string `json:"name"`
+	URLs int    `json:"urls"`
+}
+
+type apiFolderRequest struct {
+	Name string `json:"name"`
+}
+
+func newAPIFolder(folder *database.Folder) apiFolder {
+	return apiFolder{
+		ID:        folder.ID,
+		Name:      folder.Name,
+		CreatedAt: folder.CreatedAt,
+		URLs:      folder.URLs,
+	}
+}
+
+// parseTags reads the comma separated tags field of the web forms.
+func parseTags(value string) ([]string, error) {
+	return utils.NormalizeTags(strings.Split(value, ","))
+}
+
+func validateFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errFolderName
+	}
+	if len(name) > maxFolderNameLength {
+		return "", errFolderNameLength
+	}
+	return name, nil
+}
+
+// checkFolder makes sure that folderID is zero or one of the user's folders.
+func (h *Handler) checkFolder(userID, folderID int64) error {
+	if folderID == 0 {
+		return nil
+	}
+
+	folder, err := h.db.GetFolder(folderID)
+	if err != nil {
+		return err
+	}
+	if folder == nil || folder.UserID != userID {
+		return errFolderNotFound
+	}
+	return nil
+}
+
+// parseFolderForm reads the folder select of the web forms, which is empty
+// for no folder.
+func (h *Handler) parseFolderForm(r *http.Request, userID int64) (int64, error) {
+	value := r.FormValue("folder_id")
+	if value == "" {
+		return 0, nil
+	}
+
+	folderID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errFolderNotFound
+	}
+	if err := h.checkFolder(userID, folderID); err != nil {
+		return 0, errFolderNotFound
+	}
+	return folderID, nil
+}
+
+func (h *Handler) foldersHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "session")
+	user, ok := session.Values["user"].(*database.User)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := validateFolderName(r.FormValue("name"))
+	if err != nil {
+		session.AddFlash(err.Error(), "error")
+		session.Save(r, w)
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	folder, err := h.db.CreateFolder(user.ID, name)
+	if err != nil {
+		if errors.Is(err, database.ErrFolderExists) {
+			session.AddFlash(errFolderExists.Error(), "error")
+		} else {
+			session.AddFlash("Error creating folder", "error")
+		}
+		session.Save(r, w)
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	session.AddFlash("Folder created", "success")
+	session.Save(r, w)
+	http.Redirect(w, r, "/dashboard?folder="+strconv.FormatInt(folder.ID, 10), http.StatusSeeOther)
+}
+
+func (h *Handler) deleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "session")
+	user, ok := session.Values["user"].(*database.User)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	folderID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/folders/delete/"), 10, 64)
+	if err != nil {
+		session.AddFlash("Invalid folder ID", "error")
+		session.Save(r, w)
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.db.DeleteFolder(folderID, user.ID); err != nil {
+		session.AddFlash("Error deleting folder", "error")
+	} else {
+		session.AddFlash("Folder deleted, its links were kept", "success")
+	}
+	session.Save(r, w)
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+func (h *Handler) apiFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.apiUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		folders, err := h.db.GetFoldersByUserID(user.ID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error loading folders")
+			return
+		}
+
+		result := make([]apiFolder, 0, len(folders))
+		for i := range folders {
+			result = append(result, newAPIFolder(&folders[i]))
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			Folders []apiFolder `json:"folders"`
+		}{
+			Folders: result,
+		})
+	case http.MethodPost:
+		var req apiFolderRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		name, err := validateFolderName(req.Name)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_folder_name", err.Error())
+			return
+		}
+
+		folder, err := h.db.CreateFolder(user.ID, name)
+		if err != nil {
+			if errors.Is(err, database.ErrFolderExists) {
+				writeJSONError(w, http.StatusConflict, "folder_exists", errFolderExists.Error())
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error creating folder")
+			return
+		}
+
+		w.Header().Set("Location", "/api/v1/folders/"+strconv.FormatInt(folder.ID, 10))
+		writeJSON(w, http.StatusCreated, newAPIFolder(folder))
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h *Handler) apiFolderHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.apiUser(w, r)
+	if !ok {
+		return
+	}
+
+	folderID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/folders/"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Folder not found")
+		return
+	}
+
+	folder, err := h.db.GetFolder(folderID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error loading folder")
+		return
+	}
+	if folder == nil || folder.UserID != user.ID {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Folder not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPatch:
+		var req apiFolderRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		name, err := validateFolderName(req.Name)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_folder_name", err.Error())
+			return
+		}
+
+		if err := h.db.RenameFolder(folder.ID, user.ID, name); err != nil {
+			if errors.Is(err, database.ErrFolderExists) {
+				writeJSONError(w, http.StatusConflict, "folder_exists", errFolderExists.Error())
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error renaming folder")
+			return
+		}
+
+		folder.Name = name
+		writeJSON(w, http.StatusOK, newAPIFolder(folder))
+	case http.MethodDelete:
+		if err := h.db.DeleteFolder(folder.ID, user.ID); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error deleting folder")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+func (h *Handler) apiTagsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.apiUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	tags, err := h.db.GetTagsByUserID(user.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error loading tags")
+		return
+	}
+
+	result := make([]apiTag, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, apiTag{Name: tag.Name, URLs: tag.URLs})
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Tags []apiTag `json:"tags"`
+	}{
+		Tags: result,
+	})
+}
@@ -1,51 +1,84 @@
 package handlers
 
 import (
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/artem-streltsov/url-shortener/internal/clicks"
 	"github.com/artem-streltsov/url-shortener/internal/database"
 	"github.com/artem-streltsov/url-shortener/internal/middleware"
 	"github.com/artem-streltsov/url-shortener/internal/safebrowsing"
-	"github.com/artem-streltsov/url-shortener/internal/utils"
 	"github.com/gorilla/sessions"
-	"github.com/skip2/go-qrcode"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Handler struct {
-	db        *database.DB
-	templates *template.Template
-	store     *sessions.CookieStore
+	db         database.Store
+	clicks     *clicks.Recorder
+	templates  *templateSet
+	static     staticFiles
+	store      *sessions.CookieStore
+	ipHashSalt string
+	safety     safebrowsing.SafetyChecker
+
+	allowUnsafeProceed bool
+	reportThreshold    int
+
+	rateLimit       int
+	rateLimitWindow time.Duration
+
+	trustProxy bool
+	hstsMaxAge time.Duration
 }
 
-func NewHandler(db *database.DB) *Handler {
-	// TODO: use environment variable
-	templatesDir := "./internal/templates"
-	templates := template.Must(template.ParseGlob(filepath.Join(templatesDir, "*.html")))
-
-	secretKey := os.Getenv("SESSION_SECRET_KEY")
-	if secretKey == "" {
-		log.Fatalf("SESSION_SECRET_KEY environment variable is not set")
+// NewHandler loads the templates from assets. secretKey signs the session
+// cookies and salts the hashed IP addresses of visitors.
+func NewHandler(db database.Store, clickRecorder *clicks.Recorder, safety safebrowsing.SafetyChecker, assets Assets, secretKey string) (*Handler, error) {
+	templateLayers, staticLayers := assets.layers()
+	staticFiles := staticFiles(staticLayers)
+	if err := staticFiles.check(); err != nil {
+		return nil, err
+	}
+	templates, err := newTemplateSet(templateLayers, template.FuncMap{"asset": staticFiles.assetURL}, assets.Dev)
+	if err != nil {
+		return nil, fmt.Errorf("error loading templates: %w", err)
 	}
 
 	store := sessions.NewCookieStore([]byte(secretKey))
-	return &Handler{db: db, templates: templates, store: store}
+	return &Handler{
+		db:              db,
+		clicks:          clickRecorder,
+		templates:       templates,
+		static:          staticFiles,
+		store:           store,
+		ipHashSalt:      secretKey,
+		safety:          safety,
+		rateLimit:       100,
+		rateLimitWindow: time.Minute,
+	}, nil
+}
+
+// SetRateLimit sets how many requests a client may make per window.
+func (h *Handler) SetRateLimit(limit int, window time.Duration) {
+	h.rateLimit = limit
+	h.rateLimitWindow = window
 }
 
 func (h *Handler) Routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", h.indexHandler)
 	mux.HandleFunc("/new", h.newURLHandler)
+	mux.HandleFunc("/bulk", h.bulkHandler)
+	mux.HandleFunc("/import", h.importHandler)
 	mux.HandleFunc("/r/", h.redirectHandler)
+	mux.HandleFunc("/p/", h.previewHandler)
+	mux.HandleFunc("/report/", h.reportHandler)
 	mux.HandleFunc("/register", h.registerHandler)
 	mux.HandleFunc("/login", h.loginHandler)
 	mux.HandleFunc("/logout", h.logoutHandler)
@@ -53,9 +86,20 @@ func (h *Handler) Routes() http.Handler {
 	mux.HandleFunc("/edit/", h.editURLHandler)
 	mux.HandleFunc("/delete/", h.deleteURLHandler)
 	mux.HandleFunc("/details/", h.urlDetailsHandler)
-
-	rl := middleware.NewRateLimiter(100, time.Minute)
-	return middleware.LoggingMiddleware(middleware.RateLimitingMiddleware(rl)(mux))
+	mux.HandleFunc("/tokens", h.tokensHandler)
+	mux.HandleFunc("/tokens/revoke/", h.revokeTokenHandler)
+	mux.HandleFunc("/folders", h.foldersHandler)
+	mux.HandleFunc("/folders/delete/", h.deleteFolderHandler)
+	h.adminRoutes(mux)
+	h.apiRoutes(mux)
+
+	// Static files are needed by every page, so they do not count towards
+	// the rate limit.
+	root := http.NewServeMux()
+	root.Handle("/static/", http.StripPrefix("/static/", h.static))
+	rl := middleware.NewRateLimiter(h.rateLimit, h.rateLimitWindow)
+	root.Handle("/", middleware.RateLimitingMiddleware(rl)(h.activeUsers(mux)))
+	return middleware.LoggingMiddleware(h.https(root))
 }
 
 func (h *Handler) indexHandler(w http.ResponseWriter, r *http.Request) {
@@ -107,13 +151,21 @@ func (h *Handler) newURLHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		session.Save(r, w)
 
+		folders, err := h.db.GetFoldersByUserID(user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		data := struct {
-			Error string
+			Folders []database.Folder
+			Error   string
 		}{
-			Error: errorMsg,
+			Folders: folders,
+			Error:   errorMsg,
 		}
 
-		err := h.templates.ExecuteTemplate(w, "new.html", data)
+		err = h.templates.ExecuteTemplate(w, "new.html", data)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -127,71 +179,90 @@ func (h *Handler) newURLHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		url := r.Form.Get("url")
 		password := r.Form.Get("password")
+		alias := strings.TrimSpace(r.Form.Get("alias"))
 
-		if url == "" {
-			session.AddFlash("URL is required", "error")
+		url, err := h.validateURL(r.Form.Get("url"))
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
 			session.Save(r, w)
 			http.Redirect(w, r, "/new", http.StatusSeeOther)
 			return
 		}
 
-		url, isValid := utils.IsValidURL(url)
-		if !isValid {
-			session.AddFlash("Invalid URL", "error")
+		if alias != "" {
+			if err := h.checkAlias(alias, 0); err != nil {
+				session.AddFlash(err.Error(), "error")
+				session.Save(r, w)
+				http.Redirect(w, r, "/new", http.StatusSeeOther)
+				return
+			}
+		}
+
+		expiresAt, maxClicks, err := parseExpiryForm(r, nil)
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
 			session.Save(r, w)
 			http.Redirect(w, r, "/new", http.StatusSeeOther)
 			return
 		}
 
-		isSafe, err := safebrowsing.IsSafeURL(url)
+		folderID, err := h.parseFolderForm(r, user.ID)
 		if err != nil {
-			session.AddFlash("The provided URL is not safe", "error")
+			session.AddFlash(err.Error(), "error")
 			session.Save(r, w)
 			http.Redirect(w, r, "/new", http.StatusSeeOther)
 			return
 		}
 
-		if !isSafe {
-			session.AddFlash("The provided URL is not safe", "error")
+		title, err := validateTitle(r.Form.Get("title"))
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
 			session.Save(r, w)
 			http.Redirect(w, r, "/new", http.StatusSeeOther)
 			return
 		}
 
-		key := utils.GenerateKey(url)
-
-		var hashedPassword string
-		if password != "" {
-			hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-			if err != nil {
-				session.AddFlash("Error hashing password", "error")
-				session.Save(r, w)
-				http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
-				return
-			}
-			hashedPassword = string(hash)
+		tags, err := parseTags(r.Form.Get("tags"))
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
+			session.Save(r, w)
+			http.Redirect(w, r, "/new", http.StatusSeeOther)
+			return
 		}
 
-		shortURL := fmt.Sprintf("http://%s/r/%s", r.Host, key)
-		qrCode, err := qrcode.Encode(shortURL, qrcode.Medium, 256)
+		hashedPassword, err := hashPassword(password)
 		if err != nil {
-			session.AddFlash("Error generating QR code", "error")
+			session.AddFlash("Error hashing password", "error")
 			session.Save(r, w)
 			http.Redirect(w, r, "/new", http.StatusSeeOther)
 			return
 		}
 
-		qrCodeBase64 := base64.StdEncoding.EncodeToString(qrCode)
-
-		if err := h.db.InsertURL(url, key, user.ID, hashedPassword, qrCodeBase64); err != nil {
-			session.AddFlash("Error inserting URL into database", "error")
+		created, err := h.db.InsertURL(markSafe(&database.URL{
+			UserID:    user.ID,
+			URL:       url,
+			Key:       alias,
+			Title:     title,
+			Password:  hashedPassword,
+			ExpiresAt: expiresAt,
+			MaxClicks: maxClicks,
+			FolderID:  folderID,
+			Tags:      tags,
+		}))
+		if err != nil {
+			if alias != "" && errors.Is(err, database.ErrKeyTaken) {
+				session.AddFlash(errAliasTaken.Error(), "error")
+			} else {
+				session.AddFlash("Error inserting URL into database", "error")
+			}
 			session.Save(r, w)
 			http.Redirect(w, r, "/new", http.StatusSeeOther)
 			return
 		}
 
+		h.saveQRCode(r, created)
+
 		session.AddFlash("URL successfully added", "success")
 		session.Save(r, w)
 		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
@@ -208,16 +279,57 @@ func (h *Handler) redirectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if strings.HasSuffix(key, previewSuffix) {
+		h.renderPreview(w, r, strings.TrimSuffix(key, previewSuffix))
+		return
+	}
+
 	url, err := h.db.GetURL(key)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
+	if url.Disabled {
+		w.WriteHeader(http.StatusGone)
+		err := h.templates.ExecuteTemplate(w, "disabled.html", nil)
+		if err != nil {
+			log.Printf("Error rendering disabled page: %v", err)
+		}
+		return
+	}
+
+	if url.IsExpired() {
+		h.renderExpired(w)
+		return
+	}
+
+	threats, err := h.linkThreats(url)
+	if err != nil {
+		http.Error(w, "Error checking URL safety", http.StatusInternalServerError)
+		return
+	}
+
+	// Visitors who chose to continue past the warning page come back with
+	// proceed set, which is carried through the password form.
+	proceed := len(threats) > 0 && r.FormValue("proceed") != "" && h.canProceed(threats)
+	if len(threats) > 0 && !proceed {
+		log.Printf("Showed safety warning for URL %d (%s): %s", url.ID, key, safebrowsing.ThreatTypes(threats))
+		h.renderSafetyWarning(w, r, url, key, threats)
+		return
+	}
+
 	if url.Password != "" {
 		switch r.Method {
 		case http.MethodGet:
-			err := h.templates.ExecuteTemplate(w, "password.html", struct{ Key string }{Key: key})
+			data := struct {
+				Key     string
+				Proceed bool
+			}{
+				Key:     key,
+				Proceed: proceed,
+			}
+			err := h.templates.ExecuteTemplate(w, "password.html", data)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 			}
@@ -234,25 +346,39 @@ func (h *Handler) redirectHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	isSafe, err := safebrowsing.IsSafeURL(url.URL)
-	if err != nil {
-		http.Error(w, "Error checking URL safety", http.StatusInternalServerError)
-		return
-	}
-
-	if !isSafe {
-		http.Error(w, "The requested URL is not safe", http.StatusForbidden)
-		return
+	if proceed {
+		log.Printf("Visitor proceeded to URL %d (%s) despite %s", url.ID, key, safebrowsing.ThreatTypes(threats))
 	}
 
-	if err := h.db.IncrementClicks(url.ID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// Clicks on links with a click limit are counted before redirecting, as
+	// the cached click count may be stale and the queue would let visitors
+	// through until it is written.
+	if url.MaxClicks > 0 {
+		counted, err := h.db.RecordLimitedClick(h.newClick(r, url, key))
+		if err != nil {
+			log.Printf("Error recording click on URL %d: %v", url.ID, err)
+			http.Error(w, "Error recording click", http.StatusInternalServerError)
+			return
+		}
+		if !counted {
+			h.renderExpired(w)
+			return
+		}
+	} else {
+		h.clicks.Record(h.newClick(r, url, key))
 	}
 
 	http.Redirect(w, r, url.URL, http.StatusFound)
 }
 
+func (h *Handler) renderExpired(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusGone)
+	err := h.templates.ExecuteTemplate(w, "expired.html", nil)
+	if err != nil {
+		log.Printf("Error rendering expired page: %v", err)
+	}
+}
+
 func (h *Handler) registerHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -341,6 +467,13 @@ func (h *Handler) loginHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if user.Disabled {
+			session.AddFlash("This account has been disabled", "error")
+			session.Save(r, w)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
 		session.Values["user"] = user
 		err = session.Save(r, w)
 		if err != nil {
@@ -399,24 +532,96 @@ func (h *Handler) dashboardHandler(w http.ResponseWriter, r *http.Request) {
 
 	session.Save(r, w)
 
-	urls, err := h.db.GetURLsByUserID(user.ID)
+	params := r.URL.Query()
+	query, err := parseURLQuery(params, user.ID)
+	if err != nil && errorMsg == "" {
+		errorMsg = err.Error()
+	}
+	query.Limit = dashboardPageSize
+	if folder := params.Get("folder"); folder != "" {
+		query.FolderID, _ = strconv.ParseInt(folder, 10, 64)
+	}
+
+	folders, err := h.db.GetFoldersByUserID(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	folderNames := make(map[int64]string, len(folders))
+	var currentFolder *database.Folder
+	for i := range folders {
+		folderNames[folders[i].ID] = folders[i].Name
+		if folders[i].ID == query.FolderID {
+			currentFolder = &folders[i]
+		}
+	}
+	if currentFolder == nil {
+		query.FolderID = 0
+	}
+
+	tags, err := h.db.GetTagsByUserID(user.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	page, err := h.db.ListURLs(query)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		// The cursor was edited or belongs to another sort order; start over.
+		query.After = ""
+		page, err = h.db.ListURLs(query)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	flagged, err := h.db.ListURLs(database.URLQuery{UserID: user.ID, Flagged: true})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var firstURL string
+	if query.After != "" {
+		firstURL = firstPageURL(params)
+	}
+
 	data := struct {
-		User    *database.User
-		URLs    []database.URL
-		Host    string
-		Success string
-		Error   string
+		User        *database.User
+		URLs        []database.URL
+		Flagged     []database.URL
+		Folders     []database.Folder
+		FolderNames map[int64]string
+		Folder      *database.Folder
+		Tags        []database.Tag
+		Tag         string
+		Search      string
+		Sort        string
+		Ascending   bool
+		NextURL     string
+		FirstURL    string
+		BaseURL     string
+		Success     string
+		Error       string
 	}{
-		User:    user,
-		URLs:    urls,
-		Host:    r.Host,
-		Success: successMsg,
-		Error:   errorMsg,
+		User:        user,
+		URLs:        page.URLs,
+		Flagged:     flagged.URLs,
+		Folders:     folders,
+		FolderNames: folderNames,
+		Folder:      currentFolder,
+		Tags:        tags,
+		Tag:         query.Tag,
+		Search:      query.Search,
+		Sort:        query.Sort,
+		Ascending:   query.Ascending,
+		NextURL:     nextPageURL(params, page.Next),
+		FirstURL:    firstURL,
+		BaseURL:     baseURL(r),
+		Success:     successMsg,
+		Error:       errorMsg,
 	}
 
 	err = h.templates.ExecuteTemplate(w, "dashboard.html", data)
@@ -466,75 +671,127 @@ func (h *Handler) editURLHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		session.Save(r, w)
 
+		aliases, err := h.db.GetAliasesByURLID(url.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		folders, err := h.db.GetFoldersByUserID(user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		data := struct {
-			URL   *database.URL
-			Host  string
-			Error string
+			URL      *database.URL
+			Aliases  []string
+			Folders  []database.Folder
+			TagsText string
+			BaseURL  string
+			Error    string
 		}{
-			URL:   url,
-			Host:  r.Host,
-			Error: errorMsg,
+			URL:      url,
+			Aliases:  aliases,
+			Folders:  folders,
+			TagsText: strings.Join(url.Tags, ", "),
+			BaseURL:  baseURL(r),
+			Error:    errorMsg,
 		}
 
-		err := h.templates.ExecuteTemplate(w, "edit.html", data)
+		err = h.templates.ExecuteTemplate(w, "edit.html", data)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	case http.MethodPost:
-		newURL := r.FormValue("url")
-		newPassword := r.FormValue("password")
-
-		if newURL == "" {
-			session.AddFlash("URL is required", "error")
+		newURL, err := h.validateURL(r.FormValue("url"))
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
 			session.Save(r, w)
 			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
 			return
 		}
 
-		newURL, isValid := utils.IsValidURL(newURL)
-		if !isValid {
-			session.AddFlash("Invalid URL provided", "error")
+		alias := strings.TrimSpace(r.FormValue("alias"))
+		if alias != "" && alias != url.Key {
+			if err := h.checkAlias(alias, url.ID); err != nil {
+				session.AddFlash(err.Error(), "error")
+				session.Save(r, w)
+				http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+				return
+			}
+		}
+
+		expiresAt, maxClicks, err := parseExpiryForm(r, url.ExpiresAt)
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
 			session.Save(r, w)
 			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
 			return
 		}
 
-		isSafe, err := safebrowsing.IsSafeURL(newURL)
+		folderID, err := h.parseFolderForm(r, user.ID)
 		if err != nil {
-			session.AddFlash("Error checking URL safety", "error")
+			session.AddFlash(err.Error(), "error")
 			session.Save(r, w)
 			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
 			return
 		}
 
-		if !isSafe {
-			session.AddFlash("The provided URL is not safe", "error")
+		title, err := validateTitle(r.FormValue("title"))
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
 			session.Save(r, w)
 			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
 			return
 		}
 
-		var hashedPassword string
-		if newPassword != "" {
-			hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
-			if err != nil {
-				session.AddFlash("Error hashing password", "error")
-				session.Save(r, w)
-				http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
-				return
-			}
-			hashedPassword = string(hash)
+		tags, err := parseTags(r.FormValue("tags"))
+		if err != nil {
+			session.AddFlash(err.Error(), "error")
+			session.Save(r, w)
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
 		}
 
-		err = h.db.UpdateURL(urlID, newURL, hashedPassword)
+		hashedPassword, err := hashPassword(r.FormValue("password"))
 		if err != nil {
-			session.AddFlash("Error updating the URL", "error")
+			session.AddFlash("Error hashing password", "error")
+			session.Save(r, w)
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+
+		url.URL = newURL
+		markSafe(url)
+		url.Title = title
+		url.Password = hashedPassword
+		url.ExpiresAt = expiresAt
+		url.MaxClicks = maxClicks
+		url.FolderID = folderID
+		url.Tags = tags
+
+		newKey := ""
+		if alias != "" && alias != url.Key {
+			newKey = alias
+		}
+
+		if err := h.db.UpdateURL(url, newKey); err != nil {
+			if errors.Is(err, database.ErrKeyTaken) {
+				session.AddFlash(errAliasTaken.Error(), "error")
+			} else {
+				session.AddFlash("Error updating the URL", "error")
+			}
 			session.Save(r, w)
 			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
 			return
 		}
 
+		if newKey != "" {
+			h.saveQRCode(r, url)
+		}
+
 		session.AddFlash("URL updated successfully", "success")
 		session.Save(r, w)
 		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
@@ -578,35 +835,60 @@ func (h *Handler) deleteURLHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) urlDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "session")
+	user, ok := session.Values["user"].(*database.User)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
 	urlID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/details/"), 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid URL ID", http.StatusBadRequest)
 		return
 	}
 
+	// Other users' URLs are reported as missing, so that their IDs cannot be
+	// probed.
 	url, err := h.db.GetURLByID(urlID)
-	if err != nil {
+	if err != nil || url.UserID != user.ID {
 		http.Error(w, "URL not found", http.StatusNotFound)
 		return
 	}
 
-	shortURL := fmt.Sprintf("http://%s/r/%s", r.Host, url.Key)
-	qrCode, err := qrcode.Encode(shortURL, qrcode.Medium, 256)
+	shortURL := makeShortURL(r, url.Key)
+	qrCode, err := generateQRCode(shortURL)
 	if err != nil {
 		http.Error(w, "Error generating QR code", http.StatusInternalServerError)
 		return
 	}
 
+	hourly, err := h.db.GetClickBuckets(url.ID, database.BucketHour, time.Now().Add(-23*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	daily, err := h.db.GetClickBuckets(url.ID, database.BucketDay, time.Now().AddDate(0, 0, -29))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	data := struct {
-		URL      *database.URL
-		QRCode   string
-		Host     string
-		ShortURL string
+		URL          *database.URL
+		QRCode       string
+		BaseURL      string
+		ShortURL     string
+		HourlyClicks []clickBar
+		DailyClicks  []clickBar
 	}{
-		URL:      url,
-		QRCode:   base64.StdEncoding.EncodeToString(qrCode),
-		Host:     r.Host,
-		ShortURL: shortURL,
+		URL:          url,
+		QRCode:       qrCode,
+		BaseURL:      baseURL(r),
+		ShortURL:     shortURL,
+		HourlyClicks: newClickBars(hourly),
+		DailyClicks:  newClickBars(daily),
 	}
 
 	err = h.templates.ExecuteTemplate(w, "details.html", data)
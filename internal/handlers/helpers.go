@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/utils"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errURLRequired = errors.New("URL is required")
+	errInvalidURL  = errors.New("Invalid URL")
+	errSafetyCheck = errors.New("Error checking URL safety")
+	errUnsafeURL   = errors.New("The provided URL is not safe")
+	errAliasTaken  = errors.New("That alias is already taken")
+	errAliasCheck  = errors.New("Error checking alias")
+
+	errInvalidExpiry    = errors.New("Invalid expiry date")
+	errExpiryInPast     = errors.New("Expiry date must be in the future")
+	errInvalidMaxClicks = errors.New("Maximum clicks must be a positive whole number")
+
+	errTitleTooLong = fmt.Errorf("Titles can be at most %d characters long", utils.MaxTitleLength)
+)
+
+// markSafe records on url that its destination has just passed validateURL,
+// which lifts a previous safety flag.
+func markSafe(url *database.URL) *database.URL {
+	now := time.Now()
+	url.SafetyStatus = database.SafetySafe
+	url.SafetyThreat = ""
+	url.LastCheckedAt = &now
+	return url
+}
+
+// expiryInputLayout is the format used by datetime-local inputs. Form values
+// are interpreted as UTC.
+const expiryInputLayout = "2006-01-02T15:04"
+
+// validateURL normalizes rawURL and checks that it is well formed and safe.
+// The returned errors are suitable for showing to the user.
+func (h *Handler) validateURL(rawURL string) (string, error) {
+	if rawURL == "" {
+		return "", errURLRequired
+	}
+
+	url, isValid := utils.IsValidURL(rawURL)
+	if !isValid {
+		return "", errInvalidURL
+	}
+
+	threats, err := h.safety.Check(url)
+	if err != nil {
+		return "", errSafetyCheck
+	}
+
+	if len(threats) > 0 {
+		return "", errUnsafeURL
+	}
+
+	return url, nil
+}
+
+// checkAlias validates a custom alias for the URL with the given ID, or for a
+// new URL if urlID is zero. An alias that the URL already owns is accepted.
+func (h *Handler) checkAlias(alias string, urlID int64) error {
+	if err := utils.ValidateAlias(alias); err != nil {
+		return err
+	}
+
+	existing, err := h.db.GetURL(alias)
+	if err != nil {
+		if errors.Is(err, database.ErrURLNotFound) {
+			return nil
+		}
+		return errAliasCheck
+	}
+
+	if existing.ID != urlID {
+		return errAliasTaken
+	}
+	return nil
+}
+
+func validateTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if len(title) > utils.MaxTitleLength {
+		return "", errTitleTooLong
+	}
+	return title, nil
+}
+
+func validateExpiry(expiresAt *time.Time, maxClicks int) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errExpiryInPast
+	}
+	if maxClicks < 0 {
+		return errInvalidMaxClicks
+	}
+	return nil
+}
+
+// parseExpiryForm parses and validates the optional expiry fields of the new
+// and edit forms. Empty fields mean the link does not expire. An expiry date
+// equal to current is accepted even if it has passed, so that other fields of
+// an expired link can still be edited.
+func parseExpiryForm(r *http.Request, current *time.Time) (*time.Time, int, error) {
+	var expiresAt *time.Time
+	if value := strings.TrimSpace(r.FormValue("expires_at")); value != "" {
+		t, err := time.ParseInLocation(expiryInputLayout, value, time.UTC)
+		if err != nil {
+			return nil, 0, errInvalidExpiry
+		}
+		expiresAt = &t
+	}
+
+	var maxClicks int
+	if value := strings.TrimSpace(r.FormValue("max_clicks")); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, 0, errInvalidMaxClicks
+		}
+		maxClicks = n
+	}
+
+	checked := expiresAt
+	if expiresAt != nil && current != nil && expiresAt.Equal(current.UTC().Truncate(time.Minute)) {
+		expiresAt = current
+		checked = nil
+	}
+
+	if err := validateExpiry(checked, maxClicks); err != nil {
+		return nil, 0, err
+	}
+	return expiresAt, maxClicks, nil
+}
+
+// hashPassword returns the bcrypt hash of password, or an empty string if no
+// password was given.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// baseURL is the scheme and host that short URLs for a request start with.
+func baseURL(r *http.Request) string {
+	return requestScheme(r) + "://" + r.Host
+}
+
+func makeShortURL(r *http.Request, key string) string {
+	return shortURL(baseURL(r), key)
+}
+
+func shortURL(base, key string) string {
+	return fmt.Sprintf("%s/r/%s", base, key)
+}
+
+func generateQRCode(content string) (string, error) {
+	qrCode, err := qrcode.Encode(content, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(qrCode), nil
+}
+
+// saveQRCode stores a QR code for a newly created or renamed URL. The
+// details page renders its own QR code, so failures are only logged.
+func (h *Handler) saveQRCode(r *http.Request, url *database.URL) {
+	qrCode, err := generateQRCode(makeShortURL(r, url.Key))
+	if err != nil {
+		log.Printf("Error generating QR code for %s: %v", url.Key, err)
+		return
+	}
+
+	if err := h.db.UpdateQRCode(url.ID, qrCode); err != nil {
+		log.Printf("Error saving QR code for %s: %v", url.Key, err)
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type schemeKey struct{}
+
+// SetTrustProxy takes the scheme and client address of requests from the
+// X-Forwarded-Proto and X-Forwarded-For headers set by a reverse proxy that
+// terminates TLS. It must only be turned on when clients cannot reach the
+// server without going through the proxy.
+func (h *Handler) SetTrustProxy(trust bool) {
+	h.trustProxy = trust
+}
+
+// SetHSTS sends a Strict-Transport-Security header with maxAge on responses to
+// HTTPS requests. Zero leaves the header out.
+func (h *Handler) SetHSTS(maxAge time.Duration) {
+	h.hstsMaxAge = maxAge
+}
+
+// SetSecureCookies restricts the session cookie to HTTPS.
+func (h *Handler) SetSecureCookies(secure bool) {
+	h.store.Options.Secure = secure
+}
+
+// https records the scheme of each request for the short URLs built from it,
+// and asks browsers to only use HTTPS from then on. Behind a trusted proxy it
+// also replaces the remote address with the client's, so that rate limits,
+// click analytics and abuse reports see the client rather than the proxy.
+func (h *Handler) https(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		} else if h.trustProxy {
+			// Proxies in a chain each append the scheme they received.
+			proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+			if proto = strings.ToLower(strings.TrimSpace(proto)); proto == "https" {
+				scheme = proto
+			}
+		}
+
+		if scheme == "https" && h.hstsMaxAge > 0 {
+			w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", int64(h.hstsMaxAge.Seconds())))
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), schemeKey{}, scheme))
+		if h.trustProxy {
+			if ip := forwardedFor(r.Header.Values("X-Forwarded-For")); ip != "" {
+				_, port, _ := net.SplitHostPort(r.RemoteAddr)
+				r.RemoteAddr = net.JoinHostPort(ip, port)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor returns the client address that the proxy in front of the
+// server added to X-Forwarded-For, or "" if there is none. Only the last
+// address is used, because the ones before it were sent by the client or by
+// proxies further out and can be forged.
+func forwardedFor(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndex(last, ","); i >= 0 {
+		last = last[i+1:]
+	}
+	ip := net.ParseIP(strings.TrimSpace(last))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// requestScheme returns the scheme that the client used for r.
+func requestScheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(schemeKey{}).(string); ok {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPSClientAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		header     []string
+		want       string
+	}{
+		{"untrusted proxy", false, []string{"203.0.113.7"}, "192.0.2.1:1234"},
+		{"no header", true, nil, "192.0.2.1:1234"},
+		{"single address", true, []string{"203.0.113.7"}, "203.0.113.7:1234"},
+		{"forged entries are ignored", true, []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7:1234"},
+		{"last of several headers", true, []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7:1234"},
+		{"IPv6", true, []string{" 2001:db8::1 "}, "[2001:db8::1]:1234"},
+		{"invalid address", true, []string{"unknown"}, "192.0.2.1:1234"},
+	}
+	for _, tt := range tests {
+		h := &Handler{trustProxy: tt.trustProxy}
+		var got string
+		handler := h.https(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.RemoteAddr
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		for _, value := range tt.header {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		if got != tt.want {
+			t.Errorf("%s: remote address is %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPSHSTS(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		tls        bool
+		proto      string
+		maxAge     time.Duration
+		wantScheme string
+		wantHSTS   string
+	}{
+		{"plain HTTP", false, false, "", time.Hour, "http", ""},
+		{"TLS", false, true, "", time.Hour, "https", "max-age=3600"},
+		{"TLS without HSTS", false, true, "", 0, "https", ""},
+		{"untrusted proxy", false, false, "https", time.Hour, "http", ""},
+		{"trusted proxy", true, false, "https", time.Hour, "https", "max-age=3600"},
+		{"trusted proxy in upper case", true, false, " HTTPS ", time.Hour, "https", "max-age=3600"},
+		{"first proxy of a chain", true, false, "https, http", time.Hour, "https", "max-age=3600"},
+		{"trusted proxy over HTTP", true, false, "http", time.Hour, "http", ""},
+		{"later proxy is ignored", true, false, "http, https", time.Hour, "http", ""},
+		{"trusted proxy without header", true, false, "", time.Hour, "http", ""},
+		{"TLS behind a proxy", true, true, "http", time.Hour, "https", "max-age=3600"},
+	}
+	for _, tt := range tests {
+		h := &Handler{trustProxy: tt.trustProxy, hstsMaxAge: tt.maxAge}
+		var scheme string
+		handler := h.https(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme = requestScheme(r)
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if tt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if scheme != tt.wantScheme {
+			t.Errorf("%s: scheme is %q, want %q", tt.name, scheme, tt.wantScheme)
+		}
+		if got := w.Header().Get("Strict-Transport-Security"); got != tt.wantHSTS {
+			t.Errorf("%s: Strict-Transport-Security is %q, want %q", tt.name, got, tt.wantHSTS)
+		}
+	}
+}
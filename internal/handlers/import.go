@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/importer"
+)
+
+const (
+	maxImportUploadSize = 5 << 20
+	maxImportLinks      = 1000
+)
+
+var (
+	errImportFile     = errors.New("Please choose a file to import")
+	errImportTooLarge = fmt.Errorf("The file can be at most %d MB, use the command line importer for larger files", maxImportUploadSize>>20)
+	errImportTooMany  = fmt.Errorf("A file can have at most %d links, use the command line importer for larger files", maxImportLinks)
+)
+
+// importResult is an importer.Result with the short URL of a created link.
+type importResult struct {
+	importer.Result
+	ShortURL string
+}
+
+func (h *Handler) importHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "session")
+	user, ok := session.Values["user"].(*database.User)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		flashes := session.Flashes("error")
+		var errorMsg string
+		if len(flashes) > 0 {
+			errorMsg, _ = flashes[0].(string)
+		}
+		session.Save(r, w)
+
+		data := struct {
+			Formats []string
+			Error   string
+		}{
+			Formats: importer.Formats,
+			Error:   errorMsg,
+		}
+
+		err := h.templates.ExecuteTemplate(w, "import.html", data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		fail := func(message string) {
+			session.AddFlash(message, "error")
+			session.Save(r, w)
+			http.Redirect(w, r, "/import", http.StatusSeeOther)
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportUploadSize)
+		if err := r.ParseMultipartForm(maxImportUploadSize); err != nil {
+			fail(errImportTooLarge.Error())
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			fail(errImportFile.Error())
+			return
+		}
+		defer file.Close()
+
+		links, err := importer.Parse(r.FormValue("format"), file)
+		if err != nil {
+			fail(fmt.Sprintf("The file could not be read: %v", err))
+			return
+		}
+		if len(links) > maxImportLinks {
+			fail(errImportTooMany.Error())
+			return
+		}
+
+		dryRun := r.FormValue("dry_run") == "on"
+		results, err := importer.New(h.db, h.safety).Import(user.ID, links, dryRun)
+		if err != nil {
+			if errors.Is(err, database.ErrKeyTaken) {
+				fail("Some links were not imported because a key was taken while importing, please try again")
+			} else {
+				fail("Error inserting URLs into database, some links may not have been imported")
+			}
+			return
+		}
+
+		var rows []importResult
+		valid := 0
+		for _, result := range results {
+			row := importResult{Result: result}
+			if result.Error == "" {
+				valid++
+				if !dryRun {
+					row.ShortURL = makeShortURL(r, result.Key)
+					if url, err := h.db.GetURL(result.Key); err == nil {
+						h.saveQRCode(r, url)
+					}
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		data := struct {
+			Results []importResult
+			DryRun  bool
+			Valid   int
+			Failed  int
+		}{
+			Results: rows,
+			DryRun:  dryRun,
+			Valid:   valid,
+			Failed:  len(results) - valid,
+		}
+
+		err = h.templates.ExecuteTemplate(w, "import_results.html", data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/safebrowsing"
+)
+
+// previewSuffix appended to a short URL shows its preview instead of
+// redirecting. Keys never contain it.
+const previewSuffix = "+"
+
+func (h *Handler) previewHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/p/")
+	if key == "" {
+		http.Error(w, "Key is required", http.StatusBadRequest)
+		return
+	}
+	h.renderPreview(w, r, key)
+}
+
+// renderPreview shows where a short URL leads without following it, so it
+// does not count as a click. The destination of a password protected link
+// stays hidden.
+func (h *Handler) renderPreview(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	url, err := h.db.GetURL(key)
+	if err != nil {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	shortURL := makeShortURL(r, key)
+	qrCode, err := generateQRCode(shortURL)
+	if err != nil {
+		http.Error(w, "Error generating QR code", http.StatusInternalServerError)
+		return
+	}
+
+	var threats []threatInfo
+	if url.IsFlagged() {
+		threats = describeThreats(safebrowsing.ParseThreatTypes(url.SafetyThreat))
+	}
+
+	destination := url.URL
+	if url.Password != "" {
+		destination = ""
+	}
+
+	data := struct {
+		Key         string
+		ShortURL    string
+		Destination string
+		URL         *database.URL
+		Threats     []threatInfo
+		QRCode      string
+	}{
+		Key:         key,
+		ShortURL:    shortURL,
+		Destination: destination,
+		URL:         url,
+		Threats:     threats,
+		QRCode:      qrCode,
+	}
+
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := h.templates.ExecuteTemplate(w, "preview.html", data); err != nil {
+		log.Printf("Error rendering preview: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+)
+
+const (
+	maxReportDetailsLength = 1000
+	maxReportContactLength = 200
+)
+
+type reportReason struct {
+	Value string
+	Label string
+}
+
+// reportReasons are offered on the report form, in this order.
+var reportReasons = []reportReason{
+	{Value: "malware", Label: "Malware or virus"},
+	{Value: "phishing", Label: "Phishing or scam"},
+	{Value: "spam", Label: "Spam"},
+	{Value: "illegal", Label: "Illegal content"},
+	{Value: "other", Label: "Something else"},
+}
+
+func validReportReason(reason string) bool {
+	for _, r := range reportReasons {
+		if r.Value == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// SetReportThreshold sets how many visitors have to report a link before it
+// is disabled automatically. Zero turns automatic disabling off.
+func (h *Handler) SetReportThreshold(threshold int) {
+	h.reportThreshold = threshold
+}
+
+func (h *Handler) reportHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/report/")
+	if key == "" {
+		http.Error(w, "Key is required", http.StatusBadRequest)
+		return
+	}
+
+	url, err := h.db.GetURL(key)
+	if err != nil {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	session, _ := h.store.Get(r, "session")
+
+	switch r.Method {
+	case http.MethodGet:
+		var errorMsg, successMsg string
+		if flashes := session.Flashes("error"); len(flashes) > 0 {
+			errorMsg, _ = flashes[0].(string)
+		}
+		if flashes := session.Flashes("success"); len(flashes) > 0 {
+			successMsg, _ = flashes[0].(string)
+		}
+		session.Save(r, w)
+
+		data := struct {
+			Key     string
+			Reasons []reportReason
+			Success string
+			Error   string
+		}{
+			Key:     key,
+			Reasons: reportReasons,
+			Success: successMsg,
+			Error:   errorMsg,
+		}
+
+		err := h.templates.ExecuteTemplate(w, "report.html", data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		reason := r.FormValue("reason")
+		details := strings.TrimSpace(r.FormValue("details"))
+		contact := strings.TrimSpace(r.FormValue("contact"))
+
+		var errorMsg string
+		switch {
+		case !validReportReason(reason):
+			errorMsg = "Please choose a reason"
+		case len(details) > maxReportDetailsLength:
+			errorMsg = "Details are too long"
+		case len(contact) > maxReportContactLength:
+			errorMsg = "Contact details are too long"
+		}
+		if errorMsg != "" {
+			session.AddFlash(errorMsg, "error")
+			session.Save(r, w)
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+
+		disabled, err := h.db.CreateAbuseReport(&database.AbuseReport{
+			URLID:        url.ID,
+			Reason:       reason,
+			Details:      details,
+			Contact:      contact,
+			ReporterHash: h.hashRemoteIP(r),
+		}, h.reportThreshold)
+		if err != nil {
+			log.Printf("Error saving abuse report for URL %d: %v", url.ID, err)
+			session.AddFlash("Error saving your report, please try again later", "error")
+			session.Save(r, w)
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+
+		log.Printf("Abuse report for URL %d (%s): %s", url.ID, key, reason)
+		if disabled {
+			log.Printf("Disabled URL %d (%s) after abuse reports", url.ID, key)
+		}
+
+		session.AddFlash("Thank you, your report has been sent to the moderators", "success")
+		session.Save(r, w)
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
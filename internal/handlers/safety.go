@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/safebrowsing"
+)
+
+// threatDescriptions explain threat types to visitors.
+var threatDescriptions = map[string]string{
+	"MALWARE":                         "The destination may try to install malicious software on your device.",
+	"SOCIAL_ENGINEERING":              "The destination may try to trick you into revealing passwords, payment details or other personal information.",
+	"UNWANTED_SOFTWARE":               "The destination may try to get you to install software that changes your browser or system in unexpected ways.",
+	"POTENTIALLY_HARMFUL_APPLICATION": "The destination may offer apps that can harm your device.",
+	safebrowsing.ThreatBlocklisted:    "The destination is on this site's blocklist.",
+}
+
+type threatInfo struct {
+	Type        string
+	Description string
+}
+
+// SetAllowUnsafeProceed lets visitors continue past the warning page for
+// links whose threats are all low severity.
+func (h *Handler) SetAllowUnsafeProceed(allow bool) {
+	h.allowUnsafeProceed = allow
+}
+
+// linkThreats returns the threats that stop url from redirecting straight
+// away. Flagged links use the threats recorded when they were flagged; other
+// links are checked now, and flagged if the check finds anything.
+func (h *Handler) linkThreats(url *database.URL) ([]safebrowsing.Threat, error) {
+	if url.IsFlagged() {
+		threats := safebrowsing.ParseThreatTypes(url.SafetyThreat)
+		if len(threats) == 0 {
+			threats = []safebrowsing.Threat{{Type: "UNKNOWN"}}
+		}
+		return threats, nil
+	}
+
+	threats, err := h.safety.Check(url.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(threats) > 0 {
+		if _, err := h.db.UpdateSafetyStatus(url.ID, url.URL, database.SafetyFlagged, safebrowsing.ThreatTypes(threats), time.Now()); err != nil {
+			log.Printf("Error flagging URL %d: %v", url.ID, err)
+		}
+	}
+	return threats, nil
+}
+
+func describeThreats(threats []safebrowsing.Threat) []threatInfo {
+	infos := make([]threatInfo, 0, len(threats))
+	for _, threat := range threats {
+		description, ok := threatDescriptions[threat.Type]
+		if !ok {
+			description = "The destination was reported as unsafe."
+		}
+		infos = append(infos, threatInfo{Type: threat.Type, Description: description})
+	}
+	return infos
+}
+
+// canProceed reports whether visitors may follow a link despite threats.
+func (h *Handler) canProceed(threats []safebrowsing.Threat) bool {
+	return h.allowUnsafeProceed && safebrowsing.Severity(threats) == safebrowsing.SeverityLow
+}
+
+// renderSafetyWarning shows the interstitial for a link with threats. The
+// owner of the link also sees the destination and when it was checked.
+func (h *Handler) renderSafetyWarning(w http.ResponseWriter, r *http.Request, url *database.URL, key string, threats []safebrowsing.Threat) {
+	session, _ := h.store.Get(r, "session")
+	user, _ := session.Values["user"].(*database.User)
+	isOwner := user != nil && user.ID == url.UserID
+
+	data := struct {
+		Key        string
+		URL        *database.URL
+		Threats    []threatInfo
+		Severity   string
+		CanProceed bool
+		IsOwner    bool
+	}{
+		Key:        key,
+		URL:        url,
+		Threats:    describeThreats(threats),
+		Severity:   safebrowsing.Severity(threats),
+		CanProceed: h.canProceed(threats),
+		IsOwner:    isOwner,
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+	if err := h.templates.ExecuteTemplate(w, "unsafe.html", data); err != nil {
+		log.Printf("Error rendering safety warning: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+)
+
+const (
+	dashboardPageSize  = 50
+	defaultAPIPageSize = 50
+	maxAPIPageSize     = 100
+)
+
+var (
+	errInvalidSort   = errors.New("Sort must be created, clicks or last_click")
+	errInvalidOrder  = errors.New("Order must be asc or desc")
+	errInvalidCursor = errors.New("Invalid cursor")
+	errInvalidLimit  = fmt.Errorf("Limit must be between 1 and %d", maxAPIPageSize)
+)
+
+// parseURLQuery reads the search, sort and pagination parameters shared by
+// the dashboard and GET /api/v1/urls: q, tag, sort, order and cursor.
+// Folders are read by the callers, which name the parameter differently.
+// The query returned with an error can still be used; it has the defaults
+// for the parameters that were not read.
+func parseURLQuery(values url.Values, userID int64) (database.URLQuery, error) {
+	q := database.URLQuery{
+		UserID: userID,
+		Search: strings.TrimSpace(values.Get("q")),
+		Tag:    strings.ToLower(strings.TrimSpace(values.Get("tag"))),
+		Sort:   database.SortCreated,
+	}
+
+	switch sort := values.Get("sort"); sort {
+	case "", database.SortCreated:
+	case database.SortClicks, database.SortLastClick:
+		q.Sort = sort
+	default:
+		return q, errInvalidSort
+	}
+
+	switch values.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return q, errInvalidOrder
+	}
+
+	q.After = values.Get("cursor")
+	return q, nil
+}
+
+// nextPageURL is the query string of the page after the current one, which
+// keeps all parameters but the cursor.
+func nextPageURL(values url.Values, next string) string {
+	if next == "" {
+		return ""
+	}
+
+	query := url.Values{}
+	for key, value := range values {
+		query[key] = value
+	}
+	query.Set("cursor", next)
+	return "?" + query.Encode()
+}
+
+// firstPageURL is the query string of the first page with the current
+// parameters.
+func firstPageURL(values url.Values) string {
+	query := url.Values{}
+	for key, value := range values {
+		if key != "cursor" {
+			query[key] = value
+		}
+	}
+	return "?" + query.Encode()
+}
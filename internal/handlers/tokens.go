@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/utils"
+)
+
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+const maxTokenNameLength = 100
+
+type apiToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+type apiCreateTokenRequest struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
+
+// scopeAllows reports whether a token with the given scope may perform a
+// request with the given method. Write tokens can also read.
+func scopeAllows(scope, method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return scope == scopeRead || scope == scopeWrite
+	default:
+		return scope == scopeWrite
+	}
+}
+
+func newAPIToken(token *database.APIToken) apiToken {
+	return apiToken{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scope:      token.Scope,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+// createAPIToken validates name and scope and stores a new token for the user.
+// The plaintext token is only available from the return value.
+func (h *Handler) createAPIToken(userID int64, name, scope string) (*database.APIToken, string, string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", "Token name is required"
+	}
+	if len(name) > maxTokenNameLength {
+		return nil, "", "Token name is too long"
+	}
+	if scope == "" {
+		scope = scopeRead
+	}
+	if scope != scopeRead && scope != scopeWrite {
+		return nil, "", "Scope must be either read or write"
+	}
+
+	plaintext, err := utils.GenerateAPIToken()
+	if err != nil {
+		return nil, "", "Error generating token"
+	}
+
+	token, err := h.db.CreateAPIToken(userID, name, utils.HashAPIToken(plaintext), scope)
+	if err != nil {
+		return nil, "", "Error saving token"
+	}
+
+	return token, plaintext, ""
+}
+
+func (h *Handler) tokensHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "session")
+	user, ok := session.Values["user"].(*database.User)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	var newToken, errorMsg string
+
+	switch r.Method {
+	case http.MethodGet:
+		flashes := session.Flashes("error")
+		if len(flashes) > 0 {
+			errorMsg, _ = flashes[0].(string)
+		}
+		session.Save(r, w)
+	case http.MethodPost:
+		// The new token is rendered directly rather than through a flash so
+		// that it never ends up in the session cookie.
+		_, newToken, errorMsg = h.createAPIToken(user.ID, r.FormValue("name"), r.FormValue("scope"))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tokens, err := h.db.GetAPITokensByUserID(user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Tokens   []database.APIToken
+		NewToken string
+		Error    string
+	}{
+		Tokens:   tokens,
+		NewToken: newToken,
+		Error:    errorMsg,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "tokens.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.store.Get(r, "session")
+	user, ok := session.Values["user"].(*database.User)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/tokens/revoke/"), 10, 64)
+	if err != nil {
+		session.AddFlash("Invalid token ID", "error")
+		session.Save(r, w)
+		http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.db.DeleteAPIToken(tokenID, user.ID); err != nil {
+		session.AddFlash("Error revoking token", "error")
+		session.Save(r, w)
+	}
+
+	http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+}
+
+// apiSessionUser authenticates token management requests. These only accept
+// the session cookie so that a leaked token cannot be used to mint new ones.
+func (h *Handler) apiSessionUser(w http.ResponseWriter, r *http.Request) (*database.User, bool) {
+	if r.Header.Get("Authorization") != "" {
+		writeJSONError(w, http.StatusForbidden, "forbidden", "API tokens cannot be managed with an API token")
+		return nil, false
+	}
+	return h.apiUser(w, r)
+}
+
+func (h *Handler) apiTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.apiSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := h.db.GetAPITokensByUserID(user.ID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error loading tokens")
+			return
+		}
+
+		result := make([]apiToken, 0, len(tokens))
+		for i := range tokens {
+			result = append(result, newAPIToken(&tokens[i]))
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			Tokens []apiToken `json:"tokens"`
+		}{
+			Tokens: result,
+		})
+	case http.MethodPost:
+		var req apiCreateTokenRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		token, plaintext, errorMsg := h.createAPIToken(user.ID, req.Name, req.Scope)
+		if errorMsg != "" {
+			writeJSONError(w, http.StatusBadRequest, "invalid_token_request", errorMsg)
+			return
+		}
+
+		result := newAPIToken(token)
+		result.Token = plaintext
+		writeJSON(w, http.StatusCreated, result)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h *Handler) apiTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.apiSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/tokens/"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Token not found")
+		return
+	}
+
+	token, err := h.db.GetAPITokenByID(tokenID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error loading token")
+		return
+	}
+	if token == nil || token.UserID != user.ID {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Token not found")
+		return
+	}
+
+	if err := h.db.DeleteAPIToken(token.ID, user.ID); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error revoking token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,171 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns maps each field of a Link to the header names it may have, in
+// order of preference. The first non-empty cell is used.
+type csvColumns map[string][]string
+
+// genericColumns also match the columns of our own link export, so that
+// links can be moved between instances.
+var genericColumns = csvColumns{
+	"key":     {"key", "alias", "keyword", "slug"},
+	"url":     {"url", "long_url", "destination"},
+	"title":   {"title"},
+	"created": {"created_at", "created"},
+	"clicks":  {"clicks"},
+	"tags":    {"tags"},
+}
+
+// bitlyColumns match the link exports of Bitly, where the key is the last
+// part of a short link such as bit.ly/3xYz12 and a custom back-half is
+// preferred over the generated one.
+var bitlyColumns = csvColumns{
+	"key":     {"custom bitlinks", "custom bitlink", "bitlink", "link", "short_url", "short url", "id"},
+	"url":     {"long url", "long_url", "destination", "url"},
+	"title":   {"title"},
+	"created": {"created", "created_at", "date created", "creation date"},
+	"clicks":  {"clicks", "total clicks", "engagements", "user clicks"},
+	"tags":    {"tags"},
+}
+
+var (
+	errInvalidCreated = errors.New("Invalid creation date")
+	errInvalidClicks  = errors.New("Clicks must be zero or a positive whole number")
+)
+
+// timeLayouts are the formats of creation dates that are understood. Times
+// without a zone are taken to be in UTC.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseCSV(r io.Reader, columns csvColumns, keyFromLink bool) ([]Link, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("the file is not valid CSV: %w", err)
+	}
+
+	positions := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheet programs start UTF-8 files with a byte order mark.
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := positions[name]; !ok {
+			positions[name] = i
+		}
+	}
+
+	found := false
+	for _, name := range columns["url"] {
+		if _, ok := positions[name]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("the first row must be a header with one of the columns %s", strings.Join(columns["url"], ", "))
+	}
+
+	var links []Link
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the file is not valid CSV: %w", err)
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		field := func(name string) string {
+			for _, column := range columns[name] {
+				i, ok := positions[column]
+				if !ok || i >= len(record) {
+					continue
+				}
+				if value := strings.TrimSpace(record[i]); value != "" {
+					return value
+				}
+			}
+			return ""
+		}
+
+		link := Link{
+			Key:   field("key"),
+			URL:   field("url"),
+			Title: field("title"),
+			Tags:  strings.FieldsFunc(field("tags"), func(r rune) bool { return r == ',' || r == ';' }),
+		}
+		if keyFromLink {
+			link.Key = keyFromShortLink(link.Key)
+		}
+
+		if value := field("created"); value != "" {
+			created, err := parseTime(value)
+			if err != nil {
+				link.Error = err.Error()
+			}
+			link.CreatedAt = created
+		}
+
+		if value := field("clicks"); value != "" {
+			clicks, err := parseClicks(value)
+			if err != nil {
+				link.Error = err.Error()
+			}
+			link.Clicks = clicks
+		}
+
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// keyFromShortLink returns the key of a short link such as
+// https://bit.ly/3xYz12. Bitly lists several custom back-halves separated by
+// commas, of which the first is used.
+func keyFromShortLink(link string) string {
+	if i := strings.IndexByte(link, ','); i >= 0 {
+		link = link[:i]
+	}
+	link = strings.TrimRight(strings.TrimSpace(link), "/")
+	if i := strings.LastIndexByte(link, '/'); i >= 0 {
+		link = link[i+1:]
+	}
+	return link
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errInvalidCreated
+}
+
+func parseClicks(value string) (int, error) {
+	clicks, err := strconv.Atoi(value)
+	if err != nil || clicks < 0 {
+		return 0, errInvalidClicks
+	}
+	return clicks, nil
+}
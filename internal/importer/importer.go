@@ -0,0 +1,231 @@
+// Package importer creates links from the exports of other URL shorteners,
+// keeping their keys, creation dates and click totals.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/safebrowsing"
+	"github.com/artem-streltsov/url-shortener/internal/utils"
+)
+
+const (
+	FormatCSV        = "csv"
+	FormatBitly      = "bitly"
+	FormatYOURLSJSON = "yourls-json"
+	FormatYOURLSSQL  = "yourls-sql"
+)
+
+// Formats lists the supported export formats.
+var Formats = []string{FormatCSV, FormatBitly, FormatYOURLSJSON, FormatYOURLSSQL}
+
+// insertBatchSize is how many links are created per transaction, so that a
+// large import does not hold one transaction open for its whole duration.
+const insertBatchSize = 500
+
+var (
+	ErrUnknownFormat = fmt.Errorf("format must be one of %s", strings.Join(Formats, ", "))
+	ErrNoLinks       = errors.New("the file has no links")
+
+	errURLRequired = errors.New("URL is required")
+	errInvalidURL  = errors.New("Invalid URL")
+	errSafetyCheck = errors.New("Error checking URL safety")
+	errUnsafeURL   = errors.New("The provided URL is not safe")
+	errKeyCheck    = errors.New("Error checking key")
+	errKeyTaken    = errors.New("The key is already used by another link")
+	errKeyImported = errors.New("The link has already been imported")
+	errDupKey      = errors.New("The key is used by an earlier link in the file")
+	errTitle       = fmt.Errorf("Titles can be at most %d characters long", utils.MaxTitleLength)
+)
+
+// Link is a link read from an export. Key is empty if the export has none,
+// in which case one is generated, and CreatedAt is zero if it is unknown.
+type Link struct {
+	Row       int
+	Key       string
+	URL       string
+	Title     string
+	CreatedAt time.Time
+	Clicks    int
+	Tags      []string
+
+	// Error is set when the link was found but could not be read, for
+	// example because of a malformed date.
+	Error string
+}
+
+// Result is the outcome of importing one link. Key is the key of the created
+// link, or the key from the export if it was not created.
+type Result struct {
+	Row   int
+	Key   string
+	URL   string
+	Error string
+}
+
+// Parse reads the links from an export in the given format.
+func Parse(format string, r io.Reader) ([]Link, error) {
+	var links []Link
+	var err error
+	switch format {
+	case FormatCSV:
+		links, err = parseCSV(r, genericColumns, false)
+	case FormatBitly:
+		links, err = parseCSV(r, bitlyColumns, true)
+	case FormatYOURLSJSON:
+		links, err = parseYOURLSJSON(r)
+	case FormatYOURLSSQL:
+		links, err = parseYOURLSSQL(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(links) == 0 {
+		return nil, ErrNoLinks
+	}
+	for i := range links {
+		links[i].Row = i + 1
+	}
+	return links, nil
+}
+
+// Importer validates links and creates them for a user.
+type Importer struct {
+	db     database.Store
+	safety safebrowsing.SafetyChecker
+}
+
+func New(db database.Store, safety safebrowsing.SafetyChecker) *Importer {
+	return &Importer{db: db, safety: safety}
+}
+
+// Import creates the valid links for the given user, and returns a result
+// for each link in order. Links are checked like new links: their
+// destination must be valid and pass the safety checker, and their key must
+// not be in use. Invalid links and links with a key conflict are skipped and
+// reported. With dryRun set nothing is created.
+func (im *Importer) Import(userID int64, links []Link, dryRun bool) ([]Result, error) {
+	results := make([]Result, len(links))
+	var pending []*database.URL
+	var pendingResults []*Result
+	keys := make(map[string]bool)
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		inserted, err := im.db.InsertURLs(pending)
+		if err != nil {
+			return err
+		}
+		for i, url := range inserted {
+			pendingResults[i].Key = url.Key
+		}
+		pending, pendingResults = nil, nil
+		return nil
+	}
+
+	for i, link := range links {
+		results[i] = Result{Row: link.Row, Key: link.Key, URL: link.URL}
+
+		url, err := im.check(userID, link)
+		if err == nil && link.Key != "" {
+			if keys[link.Key] {
+				err = errDupKey
+			}
+			keys[link.Key] = true
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if dryRun {
+			continue
+		}
+		pending = append(pending, url)
+		pendingResults = append(pendingResults, &results[i])
+		if len(pending) == insertBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (im *Importer) check(userID int64, link Link) (*database.URL, error) {
+	if link.Error != "" {
+		return nil, errors.New(link.Error)
+	}
+
+	if link.URL == "" {
+		return nil, errURLRequired
+	}
+	dest, ok := utils.IsValidURL(link.URL)
+	if !ok {
+		return nil, errInvalidURL
+	}
+
+	if link.Key != "" {
+		if err := utils.ValidateImportedKey(link.Key); err != nil {
+			return nil, err
+		}
+
+		existing, err := im.db.GetURL(link.Key)
+		if err == nil {
+			// Running the same import again reports the links it already
+			// created rather than calling them conflicts.
+			if existing.UserID == userID && existing.URL == dest {
+				return nil, errKeyImported
+			}
+			return nil, errKeyTaken
+		}
+		if !errors.Is(err, database.ErrURLNotFound) {
+			return nil, errKeyCheck
+		}
+	}
+
+	title := strings.TrimSpace(link.Title)
+	if len(title) > utils.MaxTitleLength {
+		return nil, errTitle
+	}
+
+	tags, err := utils.NormalizeTags(link.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	threats, err := im.safety.Check(dest)
+	if err != nil {
+		return nil, errSafetyCheck
+	}
+	if len(threats) > 0 {
+		return nil, errUnsafeURL
+	}
+
+	now := time.Now()
+	return &database.URL{
+		UserID:        userID,
+		URL:           dest,
+		Key:           link.Key,
+		Title:         title,
+		CreatedAt:     link.CreatedAt,
+		Clicks:        link.Clicks,
+		Tags:          tags,
+		SafetyStatus:  database.SafetySafe,
+		LastCheckedAt: &now,
+	}, nil
+}
@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, min, sec int) time.Time {
+	return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+}
+
+// sameLinks compares links, treating missing and empty tags alike.
+func sameLinks(got, want []Link) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		a, b := got[i], want[i]
+		if len(a.Tags) == 0 && len(b.Tags) == 0 {
+			a.Tags, b.Tags = nil, nil
+		}
+		if !reflect.DeepEqual(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		format string
+		file   string
+		want   []Link
+	}{
+		{
+			format: FormatCSV,
+			file:   "links.csv",
+			want: []Link{
+				{Row: 1, Key: "launch", URL: "https://example.com/blog/launch", Title: "Launch, part 1", CreatedAt: date(2024, 1, 2, 3, 4, 5), Clicks: 12, Tags: []string{"news", "tech"}},
+				{Row: 2, URL: "https://example.com/pricing", CreatedAt: date(2024, 2, 3, 10, 20, 30)},
+				{Row: 3, Key: "docs", URL: "https://example.com/docs", Title: "Docs", CreatedAt: date(2024, 3, 4, 0, 0, 0), Tags: []string{"guides", " reference"}},
+				{Row: 4, Key: "old", URL: "https://example.com/old", Title: "Old", Error: errInvalidClicks.Error()},
+			},
+		},
+		{
+			format: FormatBitly,
+			file:   "bitly.csv",
+			want: []Link{
+				{Row: 1, Key: "spring-sale", URL: "https://shop.example.com/spring?utm_source=bitly", Title: "Spring sale", CreatedAt: date(2024, 3, 1, 12, 30, 0), Clicks: 150, Tags: []string{"marketing"}},
+				{Row: 2, Key: "4AbC98", URL: "https://example.com/", CreatedAt: date(2024, 3, 2, 7, 0, 0), Clicks: 7},
+			},
+		},
+		{
+			format: FormatYOURLSJSON,
+			file:   "yourls-api.json",
+			want: []Link{
+				{Row: 1, Key: "abc", URL: "https://example.com/a", Title: "Example A", CreatedAt: date(2024, 1, 2, 3, 4, 5), Clicks: 5},
+				{Row: 2, Key: "def", URL: "https://example.com/d", CreatedAt: date(2024, 1, 3, 3, 4, 5), Clicks: 17},
+				{Row: 3, Key: "xyz", URL: "https://example.com/z", Title: "Example Z", CreatedAt: date(2024, 1, 12, 0, 0, 0)},
+			},
+		},
+		{
+			format: FormatYOURLSJSON,
+			file:   "yourls-phpmyadmin.json",
+			want: []Link{
+				{Row: 1, Key: "abc", URL: "https://example.com/a", Title: `Example "A"`, CreatedAt: date(2024, 1, 2, 3, 4, 5), Clicks: 5},
+				{Row: 2, Key: "def", URL: "https://example.com/d", CreatedAt: date(2024, 1, 3, 3, 4, 5), Clicks: 17},
+			},
+		},
+		{
+			format: FormatYOURLSSQL,
+			file:   "yourls-mysqldump.sql",
+			want: []Link{
+				{Row: 1, Key: "abc", URL: "https://example.com/a?x=1;y=2", Title: `It's a "test"`, CreatedAt: date(2024, 1, 2, 3, 4, 5), Clicks: 5},
+				{Row: 2, Key: "def", URL: "https://example.com/-- not a comment", Title: `O'Brien\Co`},
+			},
+		},
+		{
+			format: FormatYOURLSSQL,
+			file:   "yourls-phpmyadmin.sql",
+			want: []Link{
+				{Row: 1, Key: "abc", URL: "https://example.com/a", Title: "O'Brien's /* not a comment */ page", CreatedAt: date(2024, 1, 2, 3, 4, 5), Clicks: 5},
+				{Row: 2, Key: "def", URL: "https://example.com/d#section", Title: "Line one\nLine two", CreatedAt: date(2024, 1, 3, 3, 4, 5), Clicks: 17},
+				{Row: 3, Key: "ghi", URL: "https://example.com/g", CreatedAt: date(2024, 1, 4, 0, 0, 0), Clicks: 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		file, err := os.Open(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		links, err := Parse(tt.format, file)
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if !sameLinks(links, tt.want) {
+			t.Errorf("%s: got\n%+v\nwant\n%+v", tt.file, links, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		wantErr error
+		want    string
+	}{
+		{name: "unknown format", format: "delicious", input: "url\nhttps://example.com/", wantErr: ErrUnknownFormat},
+		{name: "empty CSV", format: FormatCSV, input: "", want: "not valid CSV"},
+		{name: "CSV without a URL column", format: FormatCSV, input: "key,title\nabc,Example\n", want: "header"},
+		{name: "Bitly export of another tool", format: FormatBitly, input: "shorturl,target\nabc,https://example.com/\n", want: "long url"},
+		{name: "unterminated CSV quote", format: FormatCSV, input: "url,title\nhttps://example.com/,\"Example\n", want: "not valid CSV"},
+		{name: "CSV header only", format: FormatCSV, input: "url,key\n\n", wantErr: ErrNoLinks},
+		{name: "invalid JSON", format: FormatYOURLSJSON, input: `{"links": {`, want: "not valid JSON"},
+		{name: "JSON without links", format: FormatYOURLSJSON, input: `{"statusCode": 200}`, wantErr: errYOURLSJSON},
+		{name: "JSON scalar", format: FormatYOURLSJSON, input: `"links"`, wantErr: errYOURLSJSON},
+		{name: "JSON array of other tables", format: FormatYOURLSJSON, input: `[{"type":"table","name":"yourls_log","data":[{"click_id":"1"}]}]`, wantErr: errYOURLSJSON},
+		{name: "JSON link that is not an object", format: FormatYOURLSJSON, input: `{"links": ["https://example.com/"]}`, wantErr: errYOURLSJSON},
+		{name: "JSON without rows", format: FormatYOURLSJSON, input: `{"links": {}}`, wantErr: ErrNoLinks},
+		{name: "SQL without yourls_url", format: FormatYOURLSSQL, input: "INSERT INTO `yourls_log` VALUES (1,'abc');", wantErr: errYOURLSSQL},
+		{name: "SQL row with too few values", format: FormatYOURLSSQL, input: "INSERT INTO yourls_url VALUES ('abc','https://example.com/');", want: "2 values for 6 columns"},
+		{name: "SQL row cut off", format: FormatYOURLSSQL, input: "INSERT INTO yourls_url (keyword, url) VALUES ('abc', 'https://exa", want: "middle of a row"},
+		{name: "SQL row without a closing parenthesis", format: FormatYOURLSSQL, input: "INSERT INTO yourls_url (keyword, url) VALUES ('abc', 'https://example.com/'", want: "middle of a row"},
+		{name: "SQL values without a separator", format: FormatYOURLSSQL, input: "INSERT INTO yourls_url (keyword, url) VALUES ('abc' 'https://example.com/');", want: "unexpected"},
+	}
+	for _, tt := range tests {
+		links, err := Parse(tt.format, strings.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("%s: got %+v, want an error", tt.name, links)
+			continue
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.want != "" && !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseFieldErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+		want   string
+	}{
+		{FormatCSV, "url,created_at\nhttps://example.com/,03/04/2024\n", errInvalidCreated.Error()},
+		{FormatCSV, "url,clicks\nhttps://example.com/,1.5\n", errInvalidClicks.Error()},
+		{FormatYOURLSJSON, `[{"keyword":"abc","url":"https://example.com/","timestamp":"0000-00-00 99:00:00"}]`, errInvalidCreated.Error()},
+		{FormatYOURLSSQL, "INSERT INTO yourls_url (keyword, url, clicks) VALUES ('abc', 'https://example.com/', -1);", errInvalidClicks.Error()},
+	}
+	for _, tt := range tests {
+		links, err := Parse(tt.format, strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.format, tt.input, err)
+			continue
+		}
+		if len(links) != 1 || links[0].Error != tt.want {
+			t.Errorf("%s %q: got %+v, want one link with error %q", tt.format, tt.input, links, tt.want)
+		}
+	}
+}
+
+func TestSplitSQL(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		want []string
+	}{
+		{"statements", "SELECT 1; SELECT 2;\nSELECT 3", []string{"SELECT 1", "SELECT 2", "SELECT 3"}},
+		{"semicolon in single quotes", "SELECT 'a;b'; SELECT 2", []string{"SELECT 'a;b'", "SELECT 2"}},
+		{"semicolon in double quotes", `SELECT "a;b"`, []string{`SELECT "a;b"`}},
+		{"semicolon in backticks", "SELECT `a;b`", []string{"SELECT `a;b`"}},
+		{"doubled quote", "SELECT 'it''s; fine'; SELECT 2", []string{"SELECT 'it''s; fine'", "SELECT 2"}},
+		{"backslash escaped quote", `SELECT 'it\'s; fine'; SELECT 2`, []string{`SELECT 'it\'s; fine'`, "SELECT 2"}},
+		{"escaped backslash before the closing quote", `SELECT 'a\\'; SELECT 2`, []string{`SELECT 'a\\'`, "SELECT 2"}},
+		{"dash comment", "-- SELECT 0;\nSELECT 1; -- trailing; comment\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"dashes without a space", "SELECT 1--1", []string{"SELECT 1--1"}},
+		{"hash comment", "# SELECT 0;\nSELECT 1", []string{"SELECT 1"}},
+		{"block comment", "/* SELECT 0; */SELECT /* ; */1", []string{"SELECT 1"}},
+		{"executable comment", "/*!40101 SET NAMES utf8mb4 */;\nSELECT 1", []string{"", "SELECT 1"}},
+		{"comment markers in quotes", "SELECT '-- a', '# b', '/* c */'", []string{"SELECT '-- a', '# b', '/* c */'"}},
+		{"unterminated comment", "SELECT 1; /* SELECT 2;", []string{"SELECT 1"}},
+		{"unterminated quote", "SELECT 'a; SELECT 2", []string{"SELECT 'a; SELECT 2"}},
+	}
+	for _, tt := range tests {
+		got := splitSQL(tt.dump)
+		for i := range got {
+			got[i] = strings.TrimSpace(got[i])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseSQLTuples(t *testing.T) {
+	tests := []struct {
+		name   string
+		values string
+		want   [][]string
+	}{
+		{"single row", "('abc', 'https://example.com/', NULL, 3)", [][]string{{"abc", "https://example.com/", "", "3"}}},
+		{"several rows", "('a',1),\n('b',2) , ('c',3)", [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}}},
+		{"doubled quotes", `('it''s', "say ""hi""")`, [][]string{{"it's", `say "hi"`}}},
+		{"backslash escapes", `('it\'s', 'a\\b', 'x\ny\tz', 'q\"')`, [][]string{{"it's", `a\b`, "x\ny\tz", `q"`}}},
+		{"other quote inside", `('say "hi"', "it's")`, [][]string{{`say "hi"`, "it's"}}},
+		{"separators in quotes", "('a,b)', '(c)')", [][]string{{"a,b)", "(c)"}}},
+		{"empty string and null", "('', null)", [][]string{{"", ""}}},
+		{"no rows", "", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseSQLTuples(tt.values)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
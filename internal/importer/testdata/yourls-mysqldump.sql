@@ -0,0 +1,39 @@
+-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)
+--
+-- Host: localhost    Database: yourls
+-- ------------------------------------------------------
+/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+/*!40101 SET NAMES utf8mb4 */;
+
+--
+-- Table structure for table `yourls_url`
+--
+
+DROP TABLE IF EXISTS `yourls_url`;
+CREATE TABLE `yourls_url` (
+  `keyword` varchar(100) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+  `url` text CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+  `title` text,
+  `timestamp` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `ip` varchar(41) NOT NULL,
+  `clicks` int unsigned NOT NULL,
+  PRIMARY KEY (`keyword`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+--
+-- Dumping data for table `yourls_options`
+--
+
+LOCK TABLES `yourls_options` WRITE;
+INSERT INTO `yourls_options` VALUES (1,'version','1.9.2'),(2,'db_version','506');
+UNLOCK TABLES;
+
+--
+-- Dumping data for table `yourls_url`
+--
+
+LOCK TABLES `yourls_url` WRITE;
+/*!40000 ALTER TABLE `yourls_url` DISABLE KEYS */;
+INSERT INTO `yourls_url` VALUES ('abc','https://example.com/a?x=1;y=2','It\'s a \"test\"','2024-01-02 03:04:05','127.0.0.1',5),('def','https://example.com/-- not a comment','O\'Brien\\Co',NULL,'::1',0);
+/*!40000 ALTER TABLE `yourls_url` ENABLE KEYS */;
+UNLOCK TABLES;
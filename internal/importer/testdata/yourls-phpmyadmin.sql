@@ -0,0 +1,19 @@
+-- phpMyAdmin SQL Dump
+-- version 5.2.1
+-- https://www.phpmyadmin.net/
+--
+-- Host: localhost
+-- Generation Time: Mar 04, 2024 at 10:20 AM
+
+SET SQL_MODE = "NO_AUTO_VALUE_ON_ZERO";
+START TRANSACTION;
+
+# Dumping data for table `yourls_url`
+
+INSERT INTO `yourls_url` (`keyword`, `url`, `title`, `timestamp`, `ip`, `clicks`) VALUES
+('abc', 'https://example.com/a', 'O''Brien''s /* not a comment */ page', '2024-01-02 03:04:05', '127.0.0.1', 5),
+('def', 'https://example.com/d#section', 'Line one\nLine two', '2024-01-03 03:04:05', '::1', 17);
+
+INSERT INTO `yourls_url` (`url`, `keyword`, `clicks`, `ip`, `timestamp`, `title`) VALUES
+('https://example.com/g', 'ghi', 3, '127.0.0.1', '2024-01-04 00:00:00', '');
+COMMIT;
@@ -0,0 +1,348 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// yourlsColumns is the column order of the yourls_url table, used for INSERT
+// statements that do not name their columns.
+var yourlsColumns = []string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+
+var (
+	errYOURLSJSON = errors.New("the file is neither the output of the YOURLS stats API nor a JSON export of the yourls_url table")
+	errYOURLSSQL  = errors.New("the file has no INSERT statements for the yourls_url table")
+
+	insertPattern = regexp.MustCompile("(?is)^\\s*INSERT\\s+(?:IGNORE\\s+)?INTO\\s+[`\"]?(\\w+)[`\"]?\\s*(?:\\(([^)]*)\\))?\\s*VALUES\\s*")
+)
+
+// yourlsLink converts a row of the yourls_url table, or a link from the
+// stats API, which has a short URL instead of a keyword.
+func yourlsLink(row map[string]string) Link {
+	link := Link{
+		Key:   row["keyword"],
+		URL:   row["url"],
+		Title: row["title"],
+	}
+	if link.Key == "" {
+		link.Key = keyFromShortLink(row["shorturl"])
+	}
+
+	if value := row["timestamp"]; value != "" {
+		created, err := parseTime(value)
+		if err != nil {
+			link.Error = err.Error()
+		}
+		link.CreatedAt = created
+	}
+
+	if value := row["clicks"]; value != "" {
+		clicks, err := parseClicks(value)
+		if err != nil {
+			link.Error = err.Error()
+		}
+		link.Clicks = clicks
+	}
+	return link
+}
+
+// parseYOURLSJSON reads either the response of the YOURLS stats API, which
+// has the links in a "links" object, or a phpMyAdmin style JSON export of the
+// yourls_url table.
+func parseYOURLSJSON(r io.Reader) ([]Link, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("the file is not valid JSON: %w", err)
+	}
+
+	var rows []interface{}
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		switch links := doc["links"].(type) {
+		case []interface{}:
+			rows = links
+		case map[string]interface{}:
+			// The API names the links link_1, link_2 and so on.
+			names := make([]string, 0, len(links))
+			for name := range links {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool {
+				a, _ := strconv.Atoi(strings.TrimPrefix(names[i], "link_"))
+				b, _ := strconv.Atoi(strings.TrimPrefix(names[j], "link_"))
+				return a < b
+			})
+			for _, name := range names {
+				rows = append(rows, links[name])
+			}
+		default:
+			return nil, errYOURLSJSON
+		}
+	case []interface{}:
+		for _, item := range doc {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if object["type"] == "table" {
+				if name, _ := object["name"].(string); isYOURLSTable(name) {
+					data, _ := object["data"].([]interface{})
+					rows = append(rows, data...)
+				}
+				continue
+			}
+			if _, ok := object["url"]; ok {
+				rows = append(rows, object)
+			}
+		}
+		if rows == nil {
+			return nil, errYOURLSJSON
+		}
+	default:
+		return nil, errYOURLSJSON
+	}
+
+	links := make([]Link, 0, len(rows))
+	for _, row := range rows {
+		object, ok := row.(map[string]interface{})
+		if !ok {
+			return nil, errYOURLSJSON
+		}
+
+		values := make(map[string]string)
+		for name, value := range object {
+			switch value := value.(type) {
+			case string:
+				values[name] = strings.TrimSpace(value)
+			case json.Number:
+				values[name] = value.String()
+			}
+		}
+		links = append(links, yourlsLink(values))
+	}
+	return links, nil
+}
+
+// parseYOURLSSQL reads the INSERT statements for the yourls_url table from a
+// MySQL dump, as written by mysqldump or phpMyAdmin. Other statements are
+// ignored.
+func parseYOURLSSQL(r io.Reader) ([]Link, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []Link
+	found := false
+	for _, statement := range splitSQL(string(data)) {
+		match := insertPattern.FindStringSubmatchIndex(statement)
+		if match == nil || !isYOURLSTable(statement[match[2]:match[3]]) {
+			continue
+		}
+		found = true
+
+		columns := yourlsColumns
+		if match[4] >= 0 {
+			columns = nil
+			for _, column := range strings.Split(statement[match[4]:match[5]], ",") {
+				columns = append(columns, strings.ToLower(strings.Trim(column, " \t\r\n`\"")))
+			}
+		}
+
+		tuples, err := parseSQLTuples(statement[match[1]:])
+		if err != nil {
+			return nil, err
+		}
+		for _, tuple := range tuples {
+			if len(tuple) != len(columns) {
+				return nil, fmt.Errorf("an INSERT statement has %d values for %d columns", len(tuple), len(columns))
+			}
+			row := make(map[string]string)
+			for i, column := range columns {
+				row[column] = strings.TrimSpace(tuple[i])
+			}
+			links = append(links, yourlsLink(row))
+		}
+	}
+
+	if !found {
+		return nil, errYOURLSSQL
+	}
+	return links, nil
+}
+
+// isYOURLSTable reports whether a table is the links table of YOURLS, which
+// is called yourls_url unless another prefix was configured.
+func isYOURLSTable(name string) bool {
+	name = strings.ToLower(name)
+	return name == "url" || strings.HasSuffix(name, "_url")
+}
+
+// splitSQL splits a dump into statements and drops comments, taking care of
+// semicolons and comment markers inside quoted strings.
+func splitSQL(dump string) []string {
+	var statements []string
+	var current strings.Builder
+	for i := 0; i < len(dump); i++ {
+		c := dump[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(dump, i)
+			current.WriteString(dump[i:end])
+			i = end - 1
+		case c == '#' || (c == '-' && strings.HasPrefix(dump[i:], "-- ")):
+			end := strings.IndexByte(dump[i:], '\n')
+			if end < 0 {
+				i = len(dump)
+			} else {
+				i += end
+			}
+		case c == '/' && strings.HasPrefix(dump[i:], "/*"):
+			end := strings.Index(dump[i+2:], "*/")
+			if end < 0 {
+				i = len(dump)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			statements = append(statements, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		statements = append(statements, current.String())
+	}
+	return statements
+}
+
+// quotedEnd returns the position just after the quoted string starting at
+// start. Quotes are escaped with a backslash or by doubling them.
+func quotedEnd(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// parseSQLTuples parses the values of an INSERT statement, such as
+// ('abc', 'https://example.com', NULL, 3), ('def', ...). NULL becomes an
+// empty string.
+func parseSQLTuples(s string) ([][]string, error) {
+	var tuples [][]string
+	i := skipSpace(s, 0)
+	for i < len(s) && s[i] == '(' {
+		var tuple []string
+		i++
+		for {
+			i = skipSpace(s, i)
+			if i >= len(s) {
+				return nil, errors.New("an INSERT statement ends in the middle of a row")
+			}
+
+			var value string
+			if s[i] == '\'' || s[i] == '"' {
+				end := quotedEnd(s, i)
+				if end < i+2 {
+					return nil, errors.New("an INSERT statement ends in the middle of a row")
+				}
+				value = unquoteSQL(s[i+1:end-1], s[i])
+				i = end
+			} else {
+				end := i
+				for end < len(s) && s[end] != ',' && s[end] != ')' {
+					end++
+				}
+				value = strings.TrimSpace(s[i:end])
+				if strings.EqualFold(value, "NULL") {
+					value = ""
+				}
+				i = end
+			}
+			tuple = append(tuple, value)
+
+			i = skipSpace(s, i)
+			if i >= len(s) {
+				return nil, errors.New("an INSERT statement ends in the middle of a row")
+			}
+			if s[i] == ')' {
+				i++
+				break
+			}
+			if s[i] != ',' {
+				return nil, fmt.Errorf("unexpected %q in an INSERT statement", s[i])
+			}
+			i++
+		}
+		tuples = append(tuples, tuple)
+
+		i = skipSpace(s, i)
+		if i < len(s) && s[i] == ',' {
+			i = skipSpace(s, i+1)
+		}
+	}
+	return tuples, nil
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && strings.IndexByte(" \t\r\n", s[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// unquoteSQL resolves the escapes MySQL uses in string literals enclosed in
+// quote.
+func unquoteSQL(s string, quote byte) string {
+	if !strings.ContainsAny(s, `\'"`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '0':
+				b.WriteByte(0)
+			case 'Z':
+				b.WriteByte(26)
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		if c == quote && i+1 < len(s) && s[i+1] == quote {
+			i++
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
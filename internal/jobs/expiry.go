@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+)
+
+// RunExpirySweeper periodically marks expired URLs, or deletes them if purge
+// is set, until ctx is cancelled.
+func RunExpirySweeper(ctx context.Context, db database.Store, interval time.Duration, purge bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sweepExpired(db, purge)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sweepExpired(db database.Store, purge bool) {
+	now := time.Now()
+
+	if purge {
+		purged, err := db.PurgeExpiredURLs(now)
+		if err != nil {
+			log.Printf("Error purging expired URLs: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("Purged %d expired URLs", purged)
+		}
+		return
+	}
+
+	marked, err := db.MarkExpiredURLs(now)
+	if err != nil {
+		log.Printf("Error marking expired URLs: %v", err)
+		return
+	}
+	if marked > 0 {
+		log.Printf("Marked %d URLs as expired", marked)
+	}
+}
@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/database"
+	"github.com/artem-streltsov/url-shortener/internal/safebrowsing"
+)
+
+// RunSafetyRescan periodically runs every stored destination through the
+// safety checker until ctx is cancelled. Links that fail are flagged, which
+// disables them.
+func RunSafetyRescan(ctx context.Context, db database.Store, checker safebrowsing.SafetyChecker, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Links checked during the last half interval are skipped, so that a
+		// restart does not check everything again while each link is still
+		// checked about once per interval.
+		rescanURLs(ctx, db, checker, time.Now().Add(-interval/2), batchSize)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RescanAll runs every stored destination through the safety checker once,
+// regardless of when it was last checked.
+func RescanAll(ctx context.Context, db database.Store, checker safebrowsing.SafetyChecker, batchSize int) {
+	rescanURLs(ctx, db, checker, time.Now(), batchSize)
+}
+
+func rescanURLs(ctx context.Context, db database.Store, checker safebrowsing.SafetyChecker, checkedBefore time.Time, batchSize int) {
+	var checked, flagged, skipped, failed int
+	var afterID int64
+
+	for ctx.Err() == nil {
+		urls, err := db.GetURLsForSafetyCheck(afterID, checkedBefore, batchSize)
+		if err != nil {
+			log.Printf("Error loading URLs to rescan: %v", err)
+			return
+		}
+		if len(urls) == 0 {
+			break
+		}
+
+		for _, url := range urls {
+			if ctx.Err() != nil {
+				break
+			}
+			afterID = url.ID
+
+			threats, err := checker.Check(url.URL)
+			if err != nil {
+				failed++
+				continue
+			}
+
+			status, threat := database.SafetySafe, ""
+			if len(threats) > 0 {
+				status, threat = database.SafetyFlagged, safebrowsing.ThreatTypes(threats)
+			}
+
+			// The link may have been edited or deleted during the check, in
+			// which case the result no longer applies.
+			updated, err := db.UpdateSafetyStatus(url.ID, url.URL, status, threat, time.Now())
+			if err != nil {
+				log.Printf("Error updating safety status of URL %d: %v", url.ID, err)
+				failed++
+				continue
+			}
+			if !updated {
+				skipped++
+				continue
+			}
+			checked++
+			if len(threats) > 0 && !url.IsFlagged() {
+				flagged++
+				log.Printf("Flagged URL %d (%s): %s", url.ID, url.Key, threat)
+			}
+		}
+	}
+
+	if checked > 0 || skipped > 0 || failed > 0 {
+		log.Printf("Rescanned %d URLs: %d newly flagged, %d changed during the check, %d failed", checked, flagged, skipped, failed)
+	}
+}
@@ -0,0 +1,185 @@
+package keygen
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sync"
+)
+
+const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+const (
+	StrategyRandom  = "random"
+	StrategyCounter = "counter"
+)
+
+const (
+	DefaultLength = 8
+	MinLength     = 4
+	MaxLength     = 32
+)
+
+// MaxCounterLength is the longest key the counter strategy produces, since
+// its key space has to fit in a uint64.
+const MaxCounterLength = 10
+
+// Generator produces candidate keys for new short URLs. Keys are not
+// guaranteed to be unused; callers retry when a key is already taken.
+type Generator interface {
+	Generate() (string, error)
+}
+
+// New returns a generator for the named strategy. start is only used by the
+// counter strategy and should be larger than any value used previously.
+func New(strategy string, length int, salt string, start uint64) (Generator, error) {
+	switch strategy {
+	case StrategyRandom:
+		return NewRandom(length)
+	case StrategyCounter:
+		return NewCounter(length, salt, start)
+	default:
+		return nil, fmt.Errorf("unknown key strategy %q", strategy)
+	}
+}
+
+type randomGenerator struct {
+	length int
+}
+
+// NewRandom returns a generator of uniformly distributed keys built from a
+// cryptographically secure source.
+func NewRandom(length int) (Generator, error) {
+	if length < MinLength || length > MaxLength {
+		return nil, fmt.Errorf("key length must be between %d and %d", MinLength, MaxLength)
+	}
+	return &randomGenerator{length: length}, nil
+}
+
+func (g *randomGenerator) Generate() (string, error) {
+	// Bytes at or above the largest multiple of len(alphabet) are discarded
+	// so that every character is equally likely.
+	const limit = 256 - 256%len(alphabet)
+
+	key := make([]byte, 0, g.length)
+	buf := make([]byte, g.length*2)
+	for len(key) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("error reading random bytes: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			key = append(key, alphabet[int(b)%len(alphabet)])
+			if len(key) == g.length {
+				break
+			}
+		}
+	}
+	return string(key), nil
+}
+
+type counterGenerator struct {
+	mu        sync.Mutex
+	next      uint64
+	minLength int
+	alphabet  string
+	salt      uint64
+}
+
+// NewCounter returns a generator that derives keys from an increasing
+// counter. Each counter value is mapped through a salted permutation of the
+// key space, so consecutive keys do not look sequential but never repeat
+// until the key space is exhausted, at which point keys get one character
+// longer.
+func NewCounter(minLength int, salt string, start uint64) (Generator, error) {
+	if minLength < MinLength || minLength > MaxCounterLength {
+		return nil, fmt.Errorf("counter key length must be between %d and %d", MinLength, MaxCounterLength)
+	}
+
+	sum := sha256.Sum256([]byte(salt))
+	return &counterGenerator{
+		next:      start,
+		minLength: minLength,
+		alphabet:  shuffle(alphabet, sum[:]),
+		salt:      binary.BigEndian.Uint64(sum[:8]),
+	}, nil
+}
+
+func (g *counterGenerator) Generate() (string, error) {
+	g.mu.Lock()
+	n := g.next
+	g.next++
+	g.mu.Unlock()
+
+	length := g.minLength
+	space := keySpace(length)
+	for n >= space {
+		if length == MaxCounterLength {
+			return "", fmt.Errorf("counter key space exhausted")
+		}
+		n -= space
+		length++
+		space = keySpace(length)
+	}
+
+	return g.encode(g.permute(n, length), length), nil
+}
+
+// permute maps n to (n*multiplier + offset) mod space for keys of the given
+// length. The multiplier is coprime to the base, and therefore to space,
+// which makes the mapping a bijection.
+func (g *counterGenerator) permute(n uint64, length int) uint64 {
+	space := keySpace(length)
+	// Mixing in the length keeps the first keys of each length from looking
+	// like the first keys of the previous one.
+	seed := g.salt + uint64(length)*0x9E3779B97F4A7C15
+	multiplier := (seed | 1) % space
+	for multiplier%31 == 0 || multiplier%2 == 0 {
+		multiplier++
+	}
+	hi, lo := bits.Mul64(n, multiplier)
+	_, product := bits.Div64(hi, lo, space)
+	// Both terms are below space, which is far below 2^63, so the sum
+	// cannot overflow.
+	sum := product + (seed>>7)%space
+	if sum >= space {
+		sum -= space
+	}
+	return sum
+}
+
+func (g *counterGenerator) encode(n uint64, length int) string {
+	base := uint64(len(g.alphabet))
+	key := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		key[i] = g.alphabet[n%base]
+		n /= base
+	}
+	return string(key)
+}
+
+func keySpace(length int) uint64 {
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		space *= uint64(len(alphabet))
+	}
+	return space
+}
+
+// shuffle deterministically permutes s using seed, so that different salts
+// produce different keys for the same counter value.
+func shuffle(s string, seed []byte) string {
+	chars := []byte(s)
+	state := seed
+	for i := len(chars) - 1; i > 0; i-- {
+		sum := sha256.Sum256(state)
+		state = sum[:]
+		j := int(binary.BigEndian.Uint64(state[:8]) % uint64(i+1))
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return string(chars)
+}
@@ -0,0 +1,175 @@
+package keygen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRandomKeysAreUniform(t *testing.T) {
+	g, err := NewRandom(MaxLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[rune]int)
+	const keys = 10000
+	for i := 0; i < keys; i++ {
+		key, err := g.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key) != MaxLength {
+			t.Fatalf("got key %q of length %d, want %d", key, len(key), MaxLength)
+		}
+		for _, c := range key {
+			if !strings.ContainsRune(alphabet, c) {
+				t.Fatalf("key %q has character %q outside the alphabet", key, c)
+			}
+			counts[c]++
+		}
+	}
+
+	// Without rejection sampling the first 256%62 = 8 characters would be
+	// 25% more likely than the others, which puts the chi-squared statistic
+	// in the thousands. 61 degrees of freedom exceed 120 with a probability
+	// below 1e-5.
+	expected := float64(keys*MaxLength) / float64(len(alphabet))
+	var chiSquared float64
+	for _, c := range alphabet {
+		d := float64(counts[c]) - expected
+		chiSquared += d * d / expected
+	}
+	if chiSquared > 120 {
+		t.Errorf("character counts are not uniform: chi-squared %.1f, counts %v", chiSquared, counts)
+	}
+}
+
+func TestNewRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		strategy string
+		length   int
+	}{
+		{StrategyRandom, MinLength - 1},
+		{StrategyRandom, MaxLength + 1},
+		{StrategyCounter, MinLength - 1},
+		{StrategyCounter, MaxCounterLength + 1},
+		{"sequential", DefaultLength},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.strategy, tt.length, "salt", 0); err == nil {
+			t.Errorf("New(%q, %d) succeeded, want an error", tt.strategy, tt.length)
+		}
+	}
+}
+
+func TestCounterPermutationIsBijective(t *testing.T) {
+	g := newTestCounter(t, MinLength, "salt", 0)
+
+	// Every value of the smallest key space has to be hit exactly once.
+	space := keySpace(MinLength)
+	seen := make([]uint64, (space+63)/64)
+	for n := uint64(0); n < space; n++ {
+		p := g.permute(n, MinLength)
+		if p >= space {
+			t.Fatalf("permute(%d) = %d is outside the key space %d", n, p, space)
+		}
+		if seen[p/64]&(1<<(p%64)) != 0 {
+			t.Fatalf("permute(%d) = %d was already produced", n, p)
+		}
+		seen[p/64] |= 1 << (p % 64)
+	}
+
+	// The larger key spaces are too big to cover, so only a run of values
+	// at the start and at the end of each is checked.
+	for length := MinLength + 1; length <= MaxCounterLength; length++ {
+		space := keySpace(length)
+		seen := make(map[uint64]bool)
+		for _, start := range []uint64{0, space - 50000} {
+			for n := start; n < start+50000; n++ {
+				p := g.permute(n, length)
+				if p >= space {
+					t.Fatalf("length %d: permute(%d) = %d is outside the key space", length, n, p)
+				}
+				if seen[p] {
+					t.Fatalf("length %d: permute(%d) = %d was already produced", length, n, p)
+				}
+				seen[p] = true
+			}
+		}
+	}
+}
+
+func TestCounterKeys(t *testing.T) {
+	a := newTestCounter(t, 6, "salt", 0)
+	b := newTestCounter(t, 6, "salt", 0)
+	other := newTestCounter(t, 6, "pepper", 0)
+
+	differ := false
+	for i := 0; i < 100; i++ {
+		keyA, keyB, keyOther := generate(t, a), generate(t, b), generate(t, other)
+		if keyA != keyB {
+			t.Fatalf("key %d: the same salt produced %q and %q", i, keyA, keyB)
+		}
+		if len(keyA) != 6 {
+			t.Fatalf("key %d: got %q, want 6 characters", i, keyA)
+		}
+		differ = differ || keyA != keyOther
+	}
+	if !differ {
+		t.Error("different salts produced the same keys")
+	}
+}
+
+func TestCounterRestartDoesNotRepeatKeys(t *testing.T) {
+	// A restarted server continues from the highest URL ID, which is at
+	// least the number of keys the previous run generated.
+	const firstRun = 1000
+	seen := make(map[string]bool)
+	g := newTestCounter(t, MinLength, "salt", 0)
+	for i := 0; i < firstRun; i++ {
+		seen[generate(t, g)] = true
+	}
+	if len(seen) != firstRun {
+		t.Fatalf("got %d distinct keys out of %d", len(seen), firstRun)
+	}
+
+	restarted := newTestCounter(t, MinLength, "salt", firstRun)
+	for i := 0; i < firstRun; i++ {
+		if key := generate(t, restarted); seen[key] {
+			t.Fatalf("restarted generator repeated key %q", key)
+		}
+	}
+}
+
+func TestCounterGrowsWhenKeySpaceIsExhausted(t *testing.T) {
+	g := newTestCounter(t, MinLength, "salt", keySpace(MinLength)-1)
+	if key := generate(t, g); len(key) != MinLength {
+		t.Errorf("last key of the key space is %q, want %d characters", key, MinLength)
+	}
+	if key := generate(t, g); len(key) != MinLength+1 {
+		t.Errorf("first key after the key space is %q, want %d characters", key, MinLength+1)
+	}
+
+	last := newTestCounter(t, MaxCounterLength, "salt", keySpace(MaxCounterLength))
+	if key, err := last.Generate(); err == nil {
+		t.Errorf("got key %q past the largest key space, want an error", key)
+	}
+}
+
+func newTestCounter(t *testing.T, length int, salt string, start uint64) *counterGenerator {
+	t.Helper()
+	g, err := NewCounter(length, salt, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g.(*counterGenerator)
+}
+
+func generate(t *testing.T, g Generator) string {
+	t.Helper()
+	key, err := g.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,116 @@
+package safebrowsing
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ThreatBlocklisted is the threat type of blocklist entries that do not name
+// one.
+const ThreatBlocklisted = "BLOCKLISTED"
+
+// Blocklist flags URLs that match a local list of domains and regular
+// expressions.
+type Blocklist struct {
+	domains map[string]string
+	regexps []blocklistRegexp
+}
+
+type blocklistRegexp struct {
+	re         *regexp.Regexp
+	threatType string
+}
+
+// NewBlocklist reads a blocklist file. Each line holds a domain, which also
+// matches its subdomains, or regex: followed by a regular expression that is
+// matched against the whole URL. A threat type such as SOCIAL_ENGINEERING
+// may follow after a space. Everything from a # that starts a word is a
+// comment, and empty lines are ignored.
+func NewBlocklist(path string) (*Blocklist, error) {
+	if path == "" {
+		return nil, fmt.Errorf("a blocklist file is required for the blocklist checker")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening blocklist: %w", err)
+	}
+	defer file.Close()
+
+	b := &Blocklist{domains: make(map[string]string)}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if strings.HasPrefix(field, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("blocklist line %d: expected a pattern and an optional threat type", lineNumber)
+		}
+
+		threatType := ThreatBlocklisted
+		if len(fields) == 2 {
+			threatType = strings.ToUpper(fields[1])
+		}
+
+		if pattern, ok := strings.CutPrefix(fields[0], "regex:"); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("blocklist line %d: %w", lineNumber, err)
+			}
+			b.regexps = append(b.regexps, blocklistRegexp{re: re, threatType: threatType})
+			continue
+		}
+
+		b.domains[normalizeHost(fields[0])] = threatType
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading blocklist: %w", err)
+	}
+
+	return b, nil
+}
+
+func (b *Blocklist) Check(rawURL string) ([]Threat, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %v", err)
+	}
+
+	// Walk up from the full host name so that blocking a domain also
+	// blocks its subdomains.
+	host := normalizeHost(parsed.Hostname())
+	for host != "" {
+		if threatType, ok := b.domains[host]; ok {
+			return []Threat{{Type: threatType, Source: CheckerBlocklist}}, nil
+		}
+		_, host, _ = strings.Cut(host, ".")
+	}
+
+	for _, entry := range b.regexps {
+		if entry.re.MatchString(rawURL) {
+			return []Threat{{Type: entry.threatType, Source: CheckerBlocklist}}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (b *Blocklist) Close() error {
+	return nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,104 @@
+package safebrowsing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testBlocklist = `
+# Domains block themselves and their subdomains.
+evil.example
+Phish.Example. SOCIAL_ENGINEERING
+sub.mixed.example malware   # the threat type is upper-cased
+
+# Regular expressions are matched against the whole URL.
+regex:^https?://[^/]+/download/.*\.exe$ UNWANTED_SOFTWARE
+regex:[?&]ref=spam(&|$)
+`
+
+func writeBlocklist(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBlocklistCheck(t *testing.T) {
+	b, err := NewBlocklist(writeBlocklist(t, testBlocklist))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url        string
+		threatType string
+	}{
+		{"https://evil.example/", ThreatBlocklisted},
+		{"http://EVIL.example:8080/path?q=1", ThreatBlocklisted},
+		{"https://a.b.evil.example/", ThreatBlocklisted},
+		{"https://evil.example./", ThreatBlocklisted},
+		{"https://user@evil.example/", ThreatBlocklisted},
+		{"https://evil.example@good.example/", ""},
+		{"https://notevil.example/", ""},
+		{"https://evil.example.org/", ""},
+		{"https://good.example/evil.example", ""},
+		{"https://phish.example/login", "SOCIAL_ENGINEERING"},
+		{"https://login.phish.example/", "SOCIAL_ENGINEERING"},
+		{"https://sub.mixed.example/", "MALWARE"},
+		{"https://a.sub.mixed.example/", "MALWARE"},
+		{"https://mixed.example/", ""},
+		{"https://files.example/download/setup.exe", "UNWANTED_SOFTWARE"},
+		{"https://files.example/download/setup.exe.txt", ""},
+		{"https://files.example/setup.exe", ""},
+		{"https://shop.example/?a=1&ref=spam", ThreatBlocklisted},
+		{"https://shop.example/?ref=spammer", ""},
+		{"https://good.example/", ""},
+	}
+	for _, tt := range tests {
+		threats, err := b.Check(tt.url)
+		if err != nil {
+			t.Errorf("Check(%q) returned %v", tt.url, err)
+			continue
+		}
+		var want []Threat
+		if tt.threatType != "" {
+			want = []Threat{{Type: tt.threatType, Source: CheckerBlocklist}}
+		}
+		if !reflect.DeepEqual(threats, want) {
+			t.Errorf("Check(%q) = %v, want %v", tt.url, threats, want)
+		}
+	}
+
+	if _, err := b.Check("http://[::1"); err == nil {
+		t.Error("Check of an unparsable URL succeeded")
+	}
+}
+
+func TestNewBlocklistErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"too many fields", "\nevil.example MALWARE extra\n", "line 2"},
+		{"invalid regexp", "regex:([a-z\n", "line 1"},
+	}
+	for _, tt := range tests {
+		_, err := NewBlocklist(writeBlocklist(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error mentioning %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := NewBlocklist(""); err == nil {
+		t.Error("NewBlocklist without a path succeeded")
+	}
+	if _, err := NewBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("NewBlocklist of a missing file succeeded")
+	}
+}
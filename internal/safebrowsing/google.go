@@ -0,0 +1,48 @@
+package safebrowsing
+
+import (
+	"fmt"
+
+	safebrowsing "github.com/google/safebrowsing"
+)
+
+// Google looks URLs up in Google Safe Browsing.
+type Google struct {
+	sb *safebrowsing.SafeBrowser
+}
+
+func NewGoogle(apiKey, dbPath string) (*Google, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("a Safe Browsing API key is required for the google checker")
+	}
+
+	config := &safebrowsing.Config{
+		APIKey: apiKey,
+		ID:     "url-shortener",
+		DBPath: dbPath,
+	}
+
+	sb, err := safebrowsing.NewSafeBrowser(*config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SafeBrowser: %v", err)
+	}
+
+	return &Google{sb: sb}, nil
+}
+
+func (g *Google) Check(url string) ([]Threat, error) {
+	matches, err := g.sb.LookupURLs([]string{url})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup URL: %v", err)
+	}
+
+	var threats []Threat
+	for _, match := range matches[0] {
+		threats = append(threats, Threat{Type: match.ThreatType.String(), Source: CheckerGoogle})
+	}
+	return threats, nil
+}
+
+func (g *Google) Close() error {
+	return g.sb.Close()
+}
@@ -2,50 +2,169 @@ package safebrowsing
 
 import (
 	"fmt"
-	"os"
+	"strings"
+)
+
+// Names of the checkers that can be selected with Config.Checkers.
+const (
+	CheckerGoogle    = "google"
+	CheckerBlocklist = "blocklist"
+	CheckerNoop      = "noop"
+)
+
+// Threat describes why a URL was considered unsafe.
+type Threat struct {
+	// Type is the category of the threat, such as MALWARE or
+	// SOCIAL_ENGINEERING.
+	Type string
+	// Source names the checker that reported the threat.
+	Source string
+}
 
-	safebrowsing "github.com/google/safebrowsing"
+const (
+	SeverityLow  = "low"
+	SeverityHigh = "high"
 )
 
-var sb *safebrowsing.SafeBrowser
+// lowSeverityThreats are threat types that are a nuisance rather than a
+// direct danger to the visitor. Everything else, including threat types this
+// package does not know about, is high severity.
+var lowSeverityThreats = map[string]bool{
+	"UNWANTED_SOFTWARE": true,
+}
 
-func InitSafeBrowsing() error {
-	apiKey := os.Getenv("SAFE_BROWSING_API_KEY")
-	if apiKey == "" {
-		return fmt.Errorf("SAFE_BROWSING_API_KEY environment variable is not set")
+// Severity returns the highest severity among threats.
+func Severity(threats []Threat) string {
+	for _, threat := range threats {
+		if !lowSeverityThreats[threat.Type] {
+			return SeverityHigh
+		}
 	}
+	return SeverityLow
+}
 
-	config := &safebrowsing.Config{
-		APIKey: apiKey,
-		ID:     "url-shortener",
-		DBPath: "database/safebrowsing_db",
+// ParseThreatTypes is the inverse of ThreatTypes. The returned threats have
+// no source.
+func ParseThreatTypes(types string) []Threat {
+	var threats []Threat
+	for _, threatType := range strings.Split(types, ",") {
+		if threatType = strings.TrimSpace(threatType); threatType != "" {
+			threats = append(threats, Threat{Type: threatType})
+		}
 	}
+	return threats
+}
 
-	var err error
-	sb, err = safebrowsing.NewSafeBrowser(*config)
-	if err != nil {
-		return fmt.Errorf("failed to create SafeBrowser: %v", err)
+// ThreatTypes lists the distinct types of threats, separated by commas.
+func ThreatTypes(threats []Threat) string {
+	var types []string
+	seen := make(map[string]bool)
+	for _, threat := range threats {
+		if !seen[threat.Type] {
+			seen[threat.Type] = true
+			types = append(types, threat.Type)
+		}
 	}
+	return strings.Join(types, ", ")
+}
 
-	return nil
+// SafetyChecker decides whether URLs are safe to redirect to. A URL is safe
+// when Check returns no threats and no error.
+type SafetyChecker interface {
+	Check(url string) ([]Threat, error)
+	Close() error
 }
 
-func IsSafeURL(url string) (bool, error) {
-	if sb == nil {
-		return false, fmt.Errorf("SafeBrowser is not initialized")
+type Config struct {
+	// Checkers lists the checkers to use in the order they are consulted.
+	Checkers []string
+
+	GoogleAPIKey string
+	// GoogleDBPath is where the Google client keeps its local threat lists.
+	GoogleDBPath string
+
+	BlocklistPath string
+}
+
+// New builds the checker described by cfg. Several checkers are chained.
+func New(cfg Config) (SafetyChecker, error) {
+	if len(cfg.Checkers) == 0 {
+		return nil, fmt.Errorf("no safety checkers configured")
+	}
+
+	var checkers []SafetyChecker
+	for _, name := range cfg.Checkers {
+		checker, err := newChecker(strings.TrimSpace(name), cfg)
+		if err != nil {
+			Chain(checkers...).Close()
+			return nil, err
+		}
+		checkers = append(checkers, checker)
+	}
+
+	if len(checkers) == 1 {
+		return checkers[0], nil
 	}
+	return Chain(checkers...), nil
+}
 
-	threats, err := sb.LookupURLs([]string{url})
-	if err != nil {
-		return false, fmt.Errorf("failed to lookup URL: %v", err)
+func newChecker(name string, cfg Config) (SafetyChecker, error) {
+	switch name {
+	case CheckerGoogle:
+		return NewGoogle(cfg.GoogleAPIKey, cfg.GoogleDBPath)
+	case CheckerBlocklist:
+		return NewBlocklist(cfg.BlocklistPath)
+	case CheckerNoop:
+		return Noop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown safety checker %q", name)
 	}
+}
+
+// Noop considers every URL safe. It is meant for development only.
+type Noop struct{}
+
+func (Noop) Check(url string) ([]Threat, error) {
+	return nil, nil
+}
 
-	isSafe := len(threats[0]) == 0
-	return isSafe, nil
+func (Noop) Close() error {
+	return nil
+}
+
+type chain []SafetyChecker
+
+// Chain consults checkers in order and stops at the first one that reports a
+// threat. An error from one checker is only returned if no other checker
+// reports a threat, so that a URL is never treated as safe because a lookup
+// failed.
+func Chain(checkers ...SafetyChecker) SafetyChecker {
+	return chain(checkers)
+}
+
+func (c chain) Check(url string) ([]Threat, error) {
+	var firstErr error
+	for _, checker := range c {
+		threats, err := checker.Check(url)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(threats) > 0 {
+			return threats, nil
+		}
+	}
+	return nil, firstErr
 }
 
-func Close() {
-	if sb != nil {
-		sb.Close()
+func (c chain) Close() error {
+	var firstErr error
+	for _, checker := range c {
+		if err := checker.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
+	return firstErr
 }
@@ -0,0 +1,178 @@
+package safebrowsing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeChecker returns fixed results and records how it was used.
+type fakeChecker struct {
+	threats  []Threat
+	err      error
+	closeErr error
+
+	checked int
+	closed  bool
+}
+
+func (f *fakeChecker) Check(url string) ([]Threat, error) {
+	f.checked++
+	return f.threats, f.err
+}
+
+func (f *fakeChecker) Close() error {
+	f.closed = true
+	return f.closeErr
+}
+
+func TestChainCheck(t *testing.T) {
+	malware := []Threat{{Type: "MALWARE", Source: "first"}}
+	phishing := []Threat{{Type: "SOCIAL_ENGINEERING", Source: "second"}}
+	errFirst := errors.New("first failed")
+	errSecond := errors.New("second failed")
+
+	tests := []struct {
+		name        string
+		checkers    []*fakeChecker
+		wantThreats []Threat
+		wantErr     error
+		wantChecked []int
+	}{
+		{
+			name:        "all safe",
+			checkers:    []*fakeChecker{{}, {}},
+			wantChecked: []int{1, 1},
+		},
+		{
+			name:        "first threat stops the chain",
+			checkers:    []*fakeChecker{{threats: malware}, {threats: phishing}},
+			wantThreats: malware,
+			wantChecked: []int{1, 0},
+		},
+		{
+			name:        "later threat",
+			checkers:    []*fakeChecker{{}, {threats: phishing}},
+			wantThreats: phishing,
+			wantChecked: []int{1, 1},
+		},
+		{
+			name:        "threat wins over an earlier error",
+			checkers:    []*fakeChecker{{err: errFirst}, {threats: phishing}},
+			wantThreats: phishing,
+			wantChecked: []int{1, 1},
+		},
+		{
+			name:        "error is not treated as safe",
+			checkers:    []*fakeChecker{{err: errFirst}, {}},
+			wantErr:     errFirst,
+			wantChecked: []int{1, 1},
+		},
+		{
+			name:        "first error is returned",
+			checkers:    []*fakeChecker{{}, {err: errFirst}, {err: errSecond}},
+			wantErr:     errFirst,
+			wantChecked: []int{1, 1, 1},
+		},
+		{
+			name: "empty chain",
+		},
+	}
+	for _, tt := range tests {
+		checkers := make([]SafetyChecker, len(tt.checkers))
+		for i, checker := range tt.checkers {
+			checkers[i] = checker
+		}
+
+		threats, err := Chain(checkers...).Check("https://example.com/")
+		if !reflect.DeepEqual(threats, tt.wantThreats) {
+			t.Errorf("%s: got threats %v, want %v", tt.name, threats, tt.wantThreats)
+		}
+		if err != tt.wantErr {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		for i, checker := range tt.checkers {
+			if checker.checked != tt.wantChecked[i] {
+				t.Errorf("%s: checker %d was called %d times, want %d", tt.name, i, checker.checked, tt.wantChecked[i])
+			}
+		}
+	}
+}
+
+func TestChainClose(t *testing.T) {
+	errFirst := errors.New("first failed")
+	checkers := []*fakeChecker{{}, {closeErr: errFirst}, {closeErr: errors.New("second failed")}}
+
+	err := Chain(checkers[0], checkers[1], checkers[2]).Close()
+	if err != errFirst {
+		t.Errorf("got %v, want %v", err, errFirst)
+	}
+	for i, checker := range checkers {
+		if !checker.closed {
+			t.Errorf("checker %d was not closed", i)
+		}
+	}
+}
+
+func TestNoop(t *testing.T) {
+	threats, err := Noop{}.Check("https://malware.testing.google.test/testing/malware/")
+	if threats != nil || err != nil {
+		t.Errorf("got %v, %v, want no threats", threats, err)
+	}
+	if err := (Noop{}).Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	path := writeBlocklist(t, "evil.example\n")
+
+	checker, err := New(Config{Checkers: []string{" noop "}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := checker.(Noop); !ok {
+		t.Errorf("a single checker is wrapped in %T", checker)
+	}
+
+	checker, err = New(Config{Checkers: []string{CheckerNoop, CheckerBlocklist}, BlocklistPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	threats, err := checker.Check("https://evil.example/")
+	if err != nil || len(threats) != 1 {
+		t.Errorf("chained blocklist returned %v, %v", threats, err)
+	}
+
+	for _, cfg := range []Config{
+		{},
+		{Checkers: []string{"unknown"}},
+		{Checkers: []string{CheckerNoop, CheckerBlocklist}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
+
+func TestSeverityAndThreatTypes(t *testing.T) {
+	low := Threat{Type: "UNWANTED_SOFTWARE"}
+	high := Threat{Type: "MALWARE"}
+	if got := Severity([]Threat{low}); got != SeverityLow {
+		t.Errorf("got %s, want %s", got, SeverityLow)
+	}
+	if got := Severity([]Threat{low, high}); got != SeverityHigh {
+		t.Errorf("got %s, want %s", got, SeverityHigh)
+	}
+	if got := Severity([]Threat{{Type: "SOMETHING_NEW"}}); got != SeverityHigh {
+		t.Errorf("unknown threat type has severity %s, want %s", got, SeverityHigh)
+	}
+
+	types := ThreatTypes([]Threat{high, low, {Type: "MALWARE", Source: "other"}})
+	if types != "MALWARE, UNWANTED_SOFTWARE" {
+		t.Errorf("got %q", types)
+	}
+	if got, want := ParseThreatTypes(types), []Threat{{Type: "MALWARE"}, {Type: "UNWANTED_SOFTWARE"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+// Command fetch downloads the third-party files listed in static.Sources
+// into the current directory. It is run by go generate in internal/static.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/artem-streltsov/url-shortener/internal/static"
+)
+
+func main() {
+	paths := make([]string, 0, len(static.Sources))
+	for path := range static.Sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := download(static.Sources[path], path); err != nil {
+			log.Fatalf("Error downloading %s: %v", path, err)
+		}
+		log.Printf("Downloaded %s", path)
+	}
+}
+
+func download(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// The file is written under a temporary name first, so that a failed
+	// download does not leave a truncated file that would be served.
+	file, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
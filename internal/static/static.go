@@ -0,0 +1,20 @@
+// Package static holds the JavaScript, CSS and fonts of the web interface,
+// which are built into the binary and served under /static/.
+package static
+
+import "embed"
+
+//go:generate go run ./fetch
+
+//go:embed js lib
+var FS embed.FS
+
+// Sources maps the third-party files in lib to where they are published.
+// The files are committed, so the binary never loads them from elsewhere;
+// go generate downloads them again after a version is changed here. The
+// server does not start if one of them is missing.
+var Sources = map[string]string{
+	"lib/bootstrap/bootstrap.min.css":       "https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css",
+	"lib/bootstrap/bootstrap.bundle.min.js": "https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/js/bootstrap.bundle.min.js",
+	"lib/bootstrap/LICENSE":                 "https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/LICENSE",
+}
@@ -0,0 +1,8 @@
+// Package templates holds the HTML templates of the web interface, which are
+// built into the binary.
+package templates
+
+import "embed"
+
+//go:embed *.html
+var FS embed.FS
@@ -1,29 +1,127 @@
 package utils
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
-	"strconv"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
 	"strings"
-	"time"
 
 	urlverifier "github.com/davidmytton/url-verifier"
 )
 
-const base62Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 64
+	MaxTitleLength = 200
+	MaxTags        = 10
+	MaxTagLength   = 32
+)
+
+var (
+	ErrTooManyTags = fmt.Errorf("A link can have at most %d tags", MaxTags)
+	ErrTagTooLong  = fmt.Errorf("Tags can be at most %d characters long and cannot contain commas", MaxTagLength)
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedAliases are rejected as custom aliases because they clash with
+// routes or could be mistaken for official pages.
+var reservedAliases = map[string]bool{
+	"admin":     true,
+	"api":       true,
+	"bulk":      true,
+	"dashboard": true,
+	"delete":    true,
+	"details":   true,
+	"edit":      true,
+	"import":    true,
+	"login":     true,
+	"logout":    true,
+	"new":       true,
+	"r":         true,
+	"register":  true,
+	"static":    true,
+	"tokens":    true,
+}
+
+func ValidateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength {
+		return fmt.Errorf("Alias must be between %d and %d characters long", MinAliasLength, MaxAliasLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return errors.New("Alias may only contain letters, digits, hyphens and underscores")
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("The alias %q is reserved", alias)
+	}
+	return nil
+}
+
+// ValidateImportedKey checks a key taken over from another URL shortener.
+// Those often use keys shorter than a custom alias may be, so only the
+// characters, the maximum length and the reserved names are checked.
+func ValidateImportedKey(key string) error {
+	if key == "" || len(key) > MaxAliasLength {
+		return fmt.Errorf("Key must be between 1 and %d characters long", MaxAliasLength)
+	}
+	if !aliasPattern.MatchString(key) {
+		return errors.New("Key may only contain letters, digits, hyphens and underscores")
+	}
+	if reservedAliases[strings.ToLower(key)] {
+		return fmt.Errorf("The key %q is reserved", key)
+	}
+	return nil
+}
+
+// NormalizeTags trims and lowercases tags and drops empty and repeated ones.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength || strings.Contains(tag, ",") {
+			return nil, ErrTagTooLong
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
 
-func encodeBytesToBase62(input []byte) string {
-	result := make([]byte, 0, 10)
-	for _, b := range input {
-		result = append(result, base62Chars[b%62])
+	if len(result) > MaxTags {
+		return nil, ErrTooManyTags
 	}
-	return string(result)
+	return result, nil
+}
+
+const apiTokenPrefix = "usk_"
+
+func GenerateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAPIToken returns the value stored in the database for token. Tokens are
+// high-entropy random strings, so a fast unsalted hash is sufficient and lets
+// us look tokens up directly.
+func HashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
 
-func GenerateKey(url string) string {
-	currentTime := strconv.FormatInt(time.Now().Unix(), 10)
-	hashInput := url + currentTime
-	hash := sha256.Sum256([]byte(hashInput))
-	return encodeBytesToBase62(hash[:])[:10]
+// HashIP pseudonymises a visitor's IP address for click analytics. The salt
+// keeps the hashes from being reversed by hashing every possible address.
+func HashIP(ip, salt string) string {
+	hash := sha256.Sum256([]byte(salt + "|" + ip))
+	return hex.EncodeToString(hash[:])
 }
 
 func IsValidURL(urlStr string) (string, bool) {
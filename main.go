@@ -3,16 +3,24 @@ package main
 import (
 	"context"
 	"encoding/gob"
+	"expvar"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/artem-streltsov/url-shortener/internal/clicks"
+	"github.com/artem-streltsov/url-shortener/internal/config"
 	"github.com/artem-streltsov/url-shortener/internal/database"
 	"github.com/artem-streltsov/url-shortener/internal/handlers"
+	"github.com/artem-streltsov/url-shortener/internal/jobs"
+	"github.com/artem-streltsov/url-shortener/internal/keygen"
 	"github.com/artem-streltsov/url-shortener/internal/safebrowsing"
 	"github.com/joho/godotenv"
 )
@@ -24,53 +32,107 @@ func init() {
 func main() {
 	godotenv.Load()
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatalf("PORT environment variable is not set")
+	flags := flag.NewFlagSet(programName, flag.ExitOnError)
+	flags.Usage = func() {
+		printUsage(flags.Output())
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
 	}
+	configFlags := config.RegisterFlags(flags)
+	flags.Parse(os.Args[1:])
 
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		log.Fatalf("DB_PATH environment variable is not set")
+	cfg, err := config.Load(configFlags)
+	if err := runCommand(cfg, err, flags.Args()); err != nil {
+		log.Fatalf("Error: %v", err)
 	}
+}
 
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		dir := filepath.Dir(dbPath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Fatalf("Error creating directory for database: %v", err)
-		}
-		file, err := os.Create(dbPath)
-		if err != nil {
-			log.Fatalf("Error creating database file: %v", err)
-		}
-		file.Close()
+// serve runs the web server until it receives SIGINT or SIGTERM.
+func serve(cfg *config.Config) error {
+	db, err := openMigratedDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	grantAdmins(db, cfg.Server.AdminUsers)
+
+	if err := setKeyGenerator(db, cfg.Keys); err != nil {
+		return err
 	}
 
-	db, err := database.NewDB(dbPath)
+	db.EnableURLCache(cfg.Cache.Size, cfg.Cache.TTL, cfg.Cache.NegativeTTL)
+	expvar.Publish("url_cache", expvar.Func(func() interface{} { return db.URLCacheStats() }))
+
+	safety, err := newSafetyChecker(cfg.Safety)
 	if err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+		return err
 	}
-	defer db.Close()
+	defer safety.Close()
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go jobs.RunExpirySweeper(jobsCtx, db, cfg.Expiry.SweepInterval, cfg.Expiry.Purge())
+	go jobs.RunSafetyRescan(jobsCtx, db, safety, cfg.Safety.RescanInterval, cfg.Safety.RescanBatchSize)
 
-	if err := safebrowsing.InitSafeBrowsing(); err != nil {
-		log.Fatalf("Error initializing Safe Browsing: %v", err)
+	clickRecorder := clicks.NewRecorder(db, cfg.Clicks.BufferSize, cfg.Clicks.BatchSize, cfg.Clicks.FlushInterval)
+	expvar.Publish("clicks", expvar.Func(func() interface{} { return clickRecorder.Stats() }))
+
+	if metricsAddr := cfg.Server.MetricsAddr; metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			log.Printf("Serving metrics at %s/debug/vars", metricsAddr)
+			if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+				log.Printf("Error serving metrics: %v", err)
+			}
+		}()
 	}
-	defer safebrowsing.Close()
 
-	handler := handlers.NewHandler(db)
+	assets := handlers.Assets{ThemeDir: cfg.Server.ThemeDir, Dev: cfg.Server.DevMode}
+	handler, err := handlers.NewHandler(db, clickRecorder, safety, assets, cfg.Server.SessionSecretKey)
+	if err != nil {
+		return err
+	}
+	handler.SetAllowUnsafeProceed(cfg.Safety.AllowProceed)
+	handler.SetReportThreshold(cfg.Safety.AbuseReportThreshold)
+	handler.SetRateLimit(cfg.Server.RateLimit, cfg.Server.RateLimitWindow)
+	handler.SetTrustProxy(cfg.Server.TrustProxy)
+	handler.SetHSTS(cfg.TLS.HSTSMaxAge)
+	handler.SetSecureCookies(cfg.TLS.Enabled())
 
 	srv := &http.Server{
-		Addr:    ":" + port,
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler: handler.Routes(),
 	}
+	redirectSrv, err := configureTLS(srv, cfg.TLS, cfg.Server.Port)
+	if err != nil {
+		return err
+	}
 
 	go func() {
-		log.Printf("Starting server at :%s", port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			log.Printf("Starting HTTPS server at %s", srv.Addr)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Starting server at %s", srv.Addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Error starting server: %v", err)
 		}
 	}()
 
+	if redirectSrv != nil {
+		go func() {
+			log.Printf("Redirecting HTTP at %s to HTTPS", redirectSrv.Addr)
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error starting HTTP redirect: %v", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -79,17 +141,116 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	stopJobs()
+
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(ctx)
+	}
+	shutdownErr := srv.Shutdown(ctx)
+	if shutdownErr != nil {
+		srv.Close()
+	}
+
+	// The server has stopped handling redirects, so the remaining clicks can
+	// be written out. They get their own timeout, as a slow shutdown may
+	// have used up the first one.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := clickRecorder.Close(flushCtx); err != nil {
+		log.Printf("Error flushing clicks: %v", err)
+	}
+
+	if shutdownErr != nil {
+		return fmt.Errorf("server forced to shutdown: %w", shutdownErr)
 	}
 
 	log.Println("Server exiting")
+	return nil
 }
 
-func getEnvWithDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// openDB connects to PostgreSQL if a database URL is configured, and
+// otherwise to the SQLite database file, creating it if needed.
+func openDB(cfg config.Database) (*database.DB, error) {
+	if cfg.URL != "" {
+		return database.OpenPostgres(cfg.URL)
+	}
+
+	dbPath := cfg.Path
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		dir := filepath.Dir(dbPath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("error creating directory for database: %w", err)
+		}
+		file, err := os.Create(dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("error creating database file: %w", err)
+		}
+		file.Close()
+	}
+
+	return database.Open(dbPath)
+}
+
+// openMigratedDB connects to the database and applies pending migrations.
+func openMigratedDB(cfg config.Database) (*database.DB, error) {
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	migrations, err := db.Migrate(false)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating database: %w", err)
+	}
+	for _, migration := range migrations {
+		log.Printf("Applied migration %s", migration)
+	}
+	return db, nil
+}
+
+// setKeyGenerator configures how keys are generated for new links.
+func setKeyGenerator(db *database.DB, cfg config.Keys) error {
+	// The counter strategy starts after the highest existing ID so that a
+	// restart does not replay keys that are already in use.
+	maxID, err := db.MaxURLID()
+	if err != nil {
+		return fmt.Errorf("error reading URL IDs: %w", err)
+	}
+
+	keyGenerator, err := keygen.New(cfg.Strategy, cfg.Length, cfg.Salt, uint64(maxID))
+	if err != nil {
+		return fmt.Errorf("error configuring key generation: %w", err)
+	}
+	db.SetKeyGenerator(keyGenerator)
+	return nil
+}
+
+func newSafetyChecker(cfg config.Safety) (safebrowsing.SafetyChecker, error) {
+	safety, err := safebrowsing.New(safebrowsing.Config{
+		Checkers:      cfg.Checkers,
+		GoogleAPIKey:  cfg.GoogleAPIKey,
+		GoogleDBPath:  cfg.GoogleDBPath,
+		BlocklistPath: cfg.BlocklistPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error initializing safety checks: %w", err)
+	}
+	log.Printf("Checking URL safety with %s", strings.Join(cfg.Checkers, ", "))
+	return safety, nil
+}
+
+// grantAdmins makes the users with the given usernames admins. Users that do
+// not exist yet are skipped, so they get the role on the first start after
+// they register.
+func grantAdmins(db *database.DB, usernames []string) {
+	for _, username := range usernames {
+		found, err := db.SetUserAdmin(username, true)
+		if err != nil {
+			log.Fatalf("Error granting admin role to %s: %v", username, err)
+		}
+		if !found {
+			log.Printf("Admin user %s does not exist", username)
+		}
 	}
-	return value
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/artem-streltsov/url-shortener/internal/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// configureTLS sets up srv to serve HTTPS on httpsPort as configured by cfg.
+// It returns the plain HTTP server that redirects to srv, which is nil if TLS
+// is off or the redirect is turned off.
+func configureTLS(srv *http.Server, cfg config.TLS, httpsPort int) (*http.Server, error) {
+	redirect := redirectToHTTPS(httpsPort)
+	switch cfg.Mode {
+	case config.TLSOff:
+		return nil, nil
+	case config.TLSFiles:
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	case config.TLSACME:
+		manager, err := newCertManager(cfg)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		// Without the HTTP listener, certificates can still be obtained
+		// with the TLS-ALPN challenge on the HTTPS port.
+		redirect = manager.HTTPHandler(redirect)
+		log.Printf("Requesting certificates for %s from %s", strings.Join(cfg.ACMEDomains, ", "), cfg.ACMEDirectory)
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+	if cfg.HTTPPort == 0 {
+		return nil, nil
+	}
+	return &http.Server{Addr: fmt.Sprintf(":%d", cfg.HTTPPort), Handler: redirect}, nil
+}
+
+// newCertManager returns a manager that requests certificates for the
+// configured domains when they are first needed and renews them before they
+// expire.
+func newCertManager(cfg config.TLS) (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: cfg.ACMEDirectory}
+	if cfg.ACMECAFile != "" {
+		pem, err := os.ReadFile(cfg.ACMECAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ACME CA file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ACMECAFile)
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cfg.ACMECacheDir),
+		HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+		Email:      cfg.ACMEEmail,
+		Client:     client,
+	}, nil
+}
+
+// redirectToHTTPS sends clients to the same URL on the HTTPS port.
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if host == "" {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		// Other methods than GET would be turned into GET by a 301.
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
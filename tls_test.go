@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artem-streltsov/url-shortener/internal/config"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		host       string
+		httpsPort  int
+		wantStatus int
+		wantURL    string
+	}{
+		{"default port", http.MethodGet, "example.com", 443, http.StatusMovedPermanently, "https://example.com/r/abc?x=1"},
+		{"HTTP port is dropped", http.MethodGet, "example.com:80", 443, http.StatusMovedPermanently, "https://example.com/r/abc?x=1"},
+		{"other HTTPS port", http.MethodGet, "example.com:8080", 8443, http.StatusMovedPermanently, "https://example.com:8443/r/abc?x=1"},
+		{"IP address", http.MethodGet, "192.0.2.1:8080", 8443, http.StatusMovedPermanently, "https://192.0.2.1:8443/r/abc?x=1"},
+		{"IPv6", http.MethodGet, "[2001:db8::1]", 443, http.StatusMovedPermanently, "https://[2001:db8::1]/r/abc?x=1"},
+		{"IPv6 with port", http.MethodGet, "[2001:db8::1]:80", 443, http.StatusMovedPermanently, "https://[2001:db8::1]/r/abc?x=1"},
+		{"IPv6 on other HTTPS port", http.MethodGet, "[2001:db8::1]:8080", 8443, http.StatusMovedPermanently, "https://[2001:db8::1]:8443/r/abc?x=1"},
+		{"HEAD", http.MethodHead, "example.com", 443, http.StatusMovedPermanently, "https://example.com/r/abc?x=1"},
+		{"POST keeps its method", http.MethodPost, "example.com", 443, http.StatusPermanentRedirect, "https://example.com/r/abc?x=1"},
+		{"PUT keeps its method", http.MethodPut, "example.com:8080", 8443, http.StatusPermanentRedirect, "https://example.com:8443/r/abc?x=1"},
+		{"no host", http.MethodGet, "", 443, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/r/abc?x=1", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		redirectToHTTPS(tt.httpsPort).ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if got := w.Header().Get("Location"); got != tt.wantURL {
+			t.Errorf("%s: redirected to %q, want %q", tt.name, got, tt.wantURL)
+		}
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for localhost and
+// its key to dir, and returns their paths and the certificate.
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+// serveTLS serves srv with its TLS configuration on a free local port until
+// the test ends, and returns the address.
+func serveTLS(t *testing.T, srv *http.Server, addr string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(listener, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String()
+}
+
+func TestConfigureTLSFiles(t *testing.T) {
+	certFile, keyFile, cert := writeTestCertificate(t, t.TempDir())
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})}
+	redirectSrv, err := configureTLS(srv, config.TLS{Mode: config.TLSFiles, CertFile: certFile, KeyFile: keyFile, HTTPPort: 8080}, 8443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirectSrv == nil || redirectSrv.Addr != ":8080" {
+		t.Errorf("got redirect server %+v, want one at :8080", redirectSrv)
+	}
+	addr := serveTLS(t, srv, "127.0.0.1:0")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("got %q", body)
+	}
+	if resp.TLS == nil || !resp.TLS.PeerCertificates[0].Equal(cert) {
+		t.Error("the server did not present the configured certificate")
+	}
+	if resp.TLS.Version < tls.VersionTLS12 || srv.TLSConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("negotiated TLS version %x with a minimum of %x", resp.TLS.Version, srv.TLSConfig.MinVersion)
+	}
+}
+
+func TestConfigureTLSFilesErrors(t *testing.T) {
+	certFile, keyFile, _ := writeTestCertificate(t, t.TempDir())
+
+	for _, cfg := range []config.TLS{
+		{Mode: config.TLSFiles, CertFile: filepath.Join(t.TempDir(), "missing.pem"), KeyFile: keyFile},
+		{Mode: config.TLSFiles, CertFile: keyFile, KeyFile: certFile},
+	} {
+		if _, err := configureTLS(&http.Server{}, cfg, 443); err == nil {
+			t.Errorf("configureTLS(%+v) succeeded", cfg)
+		}
+	}
+
+	srv := &http.Server{}
+	redirectSrv, err := configureTLS(srv, config.TLS{Mode: config.TLSOff, HTTPPort: 80}, 443)
+	if err != nil || redirectSrv != nil || srv.TLSConfig != nil {
+		t.Errorf("TLS off: got %+v, %v and TLS config %v", redirectSrv, err, srv.TLSConfig)
+	}
+}
+
+// TestConfigureTLSACME obtains a certificate from a Pebble test server. It
+// needs TEST_ACME_DIRECTORY, such as https://localhost:14000/dir, and
+// TEST_ACME_CA_FILE with Pebble's test/certs/pebble.minica.pem. Pebble has
+// to resolve TEST_ACME_DOMAIN, shortener.test by default, to this machine,
+// for example with pebble-challtestsrv as its DNS server, and validate
+// TLS-ALPN challenges on TEST_ACME_TLS_PORT, 5001 by default.
+func TestConfigureTLSACME(t *testing.T) {
+	directory := os.Getenv("TEST_ACME_DIRECTORY")
+	if directory == "" {
+		t.Skip("TEST_ACME_DIRECTORY is not set")
+	}
+	domain := os.Getenv("TEST_ACME_DOMAIN")
+	if domain == "" {
+		domain = "shortener.test"
+	}
+	port := os.Getenv("TEST_ACME_TLS_PORT")
+	if port == "" {
+		port = "5001"
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})}
+	directory, caFile := pebbleProxy(t, directory, os.Getenv("TEST_ACME_CA_FILE"))
+	_, err := configureTLS(srv, config.TLS{
+		Mode:          config.TLSACME,
+		ACMEDomains:   []string{domain},
+		ACMEDirectory: directory,
+		ACMECAFile:    caFile,
+		ACMECacheDir:  t.TempDir(),
+	}, 443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, srv, net.JoinHostPort("", port))
+
+	// Pebble issues from a root that is generated when it starts, so the
+	// chain is not verified here, only that it is for the domain.
+	client := &http.Client{
+		Timeout:   2 * time.Minute,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{ServerName: domain, InsecureSkipVerify: true}},
+	}
+	defer client.CloseIdleConnections()
+
+	_, port, _ = net.SplitHostPort(addr)
+	resp, err := client.Get("https://" + net.JoinHostPort("127.0.0.1", port) + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	leaf := resp.TLS.PeerCertificates[0]
+	if err := leaf.VerifyHostname(domain); err != nil {
+		t.Error(err)
+	}
+	if leaf.Issuer.String() == leaf.Subject.String() {
+		t.Errorf("got a self-signed certificate from %s", leaf.Issuer)
+	}
+
+	// Other names are refused rather than requested.
+	other := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{ServerName: "other." + domain, InsecureSkipVerify: true}}}
+	defer other.CloseIdleConnections()
+	if resp, err := other.Get("https://" + net.JoinHostPort("127.0.0.1", port) + "/"); err == nil {
+		resp.Body.Close()
+		t.Error("a certificate was served for a domain that is not configured")
+	}
+}
+
+// pebbleProxy forwards requests to the ACME server at directory, whose root
+// certificate is in caFile, and returns the directory URL of the proxy and a
+// file with the root certificates of both. Pebble finalizes orders in the
+// background but leaves the order URL out of the response, which
+// golang.org/x/crypto/acme needs to wait for the certificate, so the proxy
+// adds it.
+func pebbleProxy(t *testing.T, directory, caFile string) (string, string) {
+	t.Helper()
+	target, err := url.Parse(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("no certificates found in %s", caFile)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: target.Scheme, Host: target.Host})
+	proxy.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		id, ok := strings.CutPrefix(resp.Request.URL.Path, "/finalize-order/")
+		if ok && resp.Header.Get("Location") == "" {
+			resp.Header.Set("Location", "https://"+resp.Request.Host+"/my-order/"+id)
+		}
+		return nil
+	}
+	srv := httptest.NewTLSServer(proxy)
+	t.Cleanup(srv.Close)
+
+	proxyCAFile := filepath.Join(t.TempDir(), "ca.pem")
+	proxyPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(proxyCAFile, append(caPEM, proxyPEM...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return srv.URL + target.RequestURI(), proxyCAFile
+}